@@ -4,16 +4,14 @@ package admin
 
 import (
 	"bytes"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jorinvo/studybot/brain"
 )
@@ -73,6 +71,19 @@ func (a Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`
 GET     /backup    Stream a backup of the current state of the database.
 DELETE  /phrase    Delete phrases. Combine query parameters 'chatid', 'phrase', 'explanation' and 'score' to select phrases.
+DELETE  /user      Delete all data of a chat. Requires query parameter 'chatid'.
+POST    /pause     Pause studies and notifications of a chat. Requires query parameter 'chatid'.
+POST    /resume    End the pause of a chat and move its studies by the paused time. Requires query parameter 'chatid'.
+                   Notifications start again once the user is active.
+GET     /reviews   Get the review log of a chat as JSON. Requires query parameter 'chatid'.
+POST    /import    Import phrases from a CSV or TSV file. Requires query parameter 'chatid'.
+                   The first row names the columns 'phrase', 'explanation', 'tags' and 'alternatives'.
+                   Send the file as body or as form field 'file'. Set 'format' to 'csv' or 'tsv' to skip detection.
+POST    /import-anki  Import the notes of an Anki package (.apkg). Requires query parameter 'chatid'.
+                   Send the file as body or as form field 'file'. Map note fields with 'fields' like
+                   'phrase=Back,explanation=Front' (default). Set 'schedule' to 'true' to keep intervals of reviewed cards.
+GET     /export    Download all phrases of a chat with study times and reviews. Requires query parameter 'chatid'.
+                   Set 'format' to 'csv' (default), 'anki' or 'jsonl'.
 GET     /studynow  Reset all study times to now. Note that this doesn't reset the notification timers.
 POST    /slack     Register in Slack as Outgoing Webhook to send responses back to users.
 `))
@@ -131,6 +142,115 @@ POST    /slack     Register in Slack as Outgoing Webhook to send responses back
 		}
 		fmt.Fprintf(w, "Deleted %d phrases.", count)
 
+	case "/user":
+		if r.Method != "DELETE" {
+			return
+		}
+		qChatID := r.URL.Query().Get("chatid")
+		chatID, err := strconv.ParseInt(qChatID, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid chatid: '%s'", qChatID), 400)
+			return
+		}
+		if err := a.store.DeleteChat(chatID); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprintf(w, "Deleted all data of chat %d.", chatID)
+
+	case "/pause":
+		if r.Method != "POST" {
+			return
+		}
+		qChatID := r.URL.Query().Get("chatid")
+		chatID, err := strconv.ParseInt(qChatID, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid chatid: '%s'", qChatID), 400)
+			return
+		}
+		if err := a.store.Pause(chatID, time.Now()); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprintf(w, "Paused chat %d.", chatID)
+
+	case "/resume":
+		if r.Method != "POST" {
+			return
+		}
+		qChatID := r.URL.Query().Get("chatid")
+		chatID, err := strconv.ParseInt(qChatID, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid chatid: '%s'", qChatID), 400)
+			return
+		}
+		paused, err := a.store.Resume(chatID, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprintf(w, "Resumed chat %d. Studies have been moved by %s.", chatID, paused)
+
+	case "/reviews":
+		if r.Method != "GET" {
+			return
+		}
+		qChatID := r.URL.Query().Get("chatid")
+		chatID, err := strconv.ParseInt(qChatID, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid chatid: '%s'", qChatID), 400)
+			return
+		}
+		reviews, err := a.store.GetReviews(chatID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(reviews); err != nil {
+			a.err.Println(err)
+		}
+
+	case "/import":
+		if r.Method != "POST" {
+			return
+		}
+		a.importPhrases(w, r)
+
+	case "/import-anki":
+		if r.Method != "POST" {
+			return
+		}
+		a.importAnki(w, r)
+
+	case "/export":
+		if r.Method != "GET" {
+			return
+		}
+		qChatID := r.URL.Query().Get("chatid")
+		chatID, err := strconv.ParseInt(qChatID, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid chatid: '%s'", qChatID), 400)
+			return
+		}
+		format := brain.Format(r.URL.Query().Get("format"))
+		if format == "" {
+			format = brain.FormatCSV
+		}
+		var buf bytes.Buffer
+		if err := a.store.Export(chatID, format, &buf); err == brain.ErrUnknownFormat {
+			http.Error(w, fmt.Sprintf("invalid format: '%s'", format), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%d.%s"`, chatID, format.Extension()))
+		if _, err := buf.WriteTo(w); err != nil {
+			a.err.Println(err)
+		}
+
 	case "/studynow":
 		if r.Method != "GET" {
 			return
@@ -208,42 +328,3 @@ func (a Admin) HandleMessage(id int64, name, msg string) {
 func slackError(w http.ResponseWriter, err error) {
 	fmt.Fprint(w, fmt.Sprintf(`{ "text": "Error sending message: %s." }`, err))
 }
-
-// Currently not in use
-func csvImport(store brain.Store, errLogger, infoLogger *log.Logger, toImport string) {
-	// CSV import
-	parts := strings.Split(toImport, ":")
-	i, err := strconv.Atoi(parts[0])
-	if err != nil {
-		errLogger.Fatal(err)
-	}
-	chatID := int64(i)
-	file := parts[1]
-	infoLogger.Printf("Importing to chat ID %d from CSV file %s", chatID, file)
-	f, err := os.Open(file)
-	if err != nil {
-		errLogger.Fatalln(err)
-	}
-	count := 0
-	reader := csv.NewReader(f)
-	for {
-		row, err := reader.Read()
-		if err == io.EOF {
-			infoLogger.Printf("Imported %d phrases", count)
-			return
-		}
-		if err != nil {
-			errLogger.Fatalln(err)
-		}
-		if len(row) != 2 {
-			errLogger.Printf("line %d has wrong number of fields, expected 2, had %d", count+1, len(row))
-		} else {
-			count++
-			p := strings.TrimSpace(row[0])
-			e := strings.TrimSpace(row[1])
-			if err = store.AddPhrase(chatID, p, e); err != nil {
-				errLogger.Fatalln(err)
-			}
-		}
-	}
-}
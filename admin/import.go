@@ -0,0 +1,278 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jorinvo/studybot/anki"
+	"github.com/jorinvo/studybot/brain"
+)
+
+// Maximum size of an uploaded file
+const maxImportSize = 10 << 20
+
+// Maximum size of an uploaded Anki package; they include media files
+const maxPackageSize = 100 << 20
+
+// Result of an import.
+// Rows are counted from 1 and the header is row 1.
+// Anki notes are identified by their note ID instead.
+type importReport struct {
+	Imported int         `json:"imported"`
+	Skipped  []importRow `json:"skipped"`
+	Failed   []importRow `json:"failed"`
+}
+
+type importRow struct {
+	Row    int    `json:"row,omitempty"`
+	Note   int64  `json:"note,omitempty"`
+	Phrase string `json:"phrase,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Indices of the known columns in the header; -1 if missing
+type importColumns struct {
+	phrase, explanation, tags, alternatives int
+}
+
+// Import phrases from a CSV or TSV upload.
+// The file is either the request body or the form field "file".
+// The first row is a header naming the columns phrase, explanation, tags and alternatives.
+// Other columns are ignored.
+func (a Admin) importPhrases(w http.ResponseWriter, r *http.Request) {
+	chatID, body, ok := a.importUpload(w, r, maxImportSize)
+	if !ok {
+		return
+	}
+	defer a.close(body)
+
+	in := bufio.NewReader(body)
+	comma, err := importSeparator(in, r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	reader := csv.NewReader(in)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	// Quotes in TSV files are usually meant literally
+	reader.LazyQuotes = comma == '\t'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read header: %v", err), 400)
+		return
+	}
+	columns, err := parseImportHeader(header)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	report := importReport{Skipped: []importRow{}, Failed: []importRow{}}
+	var phrases []brain.Phrase
+	// Row of each phrase to report skipped ones
+	var rows []importRow
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(*csv.ParseError); ok {
+			report.Failed = append(report.Failed, importRow{Row: row, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read row %d: %v", row, err), 400)
+			return
+		}
+		p, reason := columns.parse(record)
+		if reason != "" {
+			report.Failed = append(report.Failed, importRow{Row: row, Phrase: p.Phrase, Reason: reason})
+			continue
+		}
+		phrases = append(phrases, p)
+		rows = append(rows, importRow{Row: row, Phrase: p.Phrase})
+	}
+	a.importAndReport(w, chatID, phrases, rows, report)
+}
+
+// Import the notes of an Anki package.
+// The file is either the request body or the form field "file".
+// The query parameter fields maps note fields to phrases like "phrase=Back,explanation=Front".
+// With schedule=true the intervals of cards in review are kept.
+func (a Admin) importAnki(w http.ResponseWriter, r *http.Request) {
+	chatID, body, ok := a.importUpload(w, r, maxPackageSize)
+	if !ok {
+		return
+	}
+	defer a.close(body)
+
+	fields, err := anki.ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	options := []func(*anki.Options){anki.MapFields(fields)}
+	if r.URL.Query().Get("schedule") == "true" {
+		options = append(options, anki.KeepSchedule)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read package: %v", err), 400)
+		return
+	}
+	notes, err := anki.Read(data, options...)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	report := importReport{Skipped: []importRow{}, Failed: []importRow{}}
+	var phrases []brain.Phrase
+	var sources []importRow
+	for _, n := range notes {
+		if n.Err != nil {
+			report.Failed = append(report.Failed, importRow{Note: n.ID, Phrase: n.Phrase.Phrase, Reason: n.Err.Error()})
+			continue
+		}
+		phrases = append(phrases, n.Phrase)
+		sources = append(sources, importRow{Note: n.ID, Phrase: n.Phrase.Phrase})
+	}
+	a.importAndReport(w, chatID, phrases, sources, report)
+}
+
+// Get the chat and the uploaded file of an import request.
+// The file is either the request body or the form field "file".
+// Responds with an error and returns false if the request is invalid.
+func (a Admin) importUpload(w http.ResponseWriter, r *http.Request, maxSize int64) (int64, io.ReadCloser, bool) {
+	qChatID := r.URL.Query().Get("chatid")
+	chatID, err := strconv.ParseInt(qChatID, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid chatid: '%s'", qChatID), 400)
+		return 0, nil, false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return chatID, r.Body, true
+	}
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read form field 'file': %v", err), 400)
+		return 0, nil, false
+	}
+	return chatID, f, true
+}
+
+func (a Admin) close(c io.Closer) {
+	if err := c.Close(); err != nil {
+		a.err.Println(err)
+	}
+}
+
+// Import the phrases, add the skipped ones to the report and respond with it.
+// Sources are the rows or notes the phrases have been read from.
+func (a Admin) importAndReport(w http.ResponseWriter, chatID int64, phrases []brain.Phrase, sources []importRow, report importReport) {
+	ids, err := a.store.ImportPhrases(chatID, phrases)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i, id := range ids {
+		if id == 0 {
+			skipped := sources[i]
+			skipped.Reason = "explanation already exists"
+			report.Skipped = append(report.Skipped, skipped)
+			continue
+		}
+		report.Imported++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		a.err.Println(err)
+	}
+}
+
+// Get the separator of the columns.
+// The format is "csv", "tsv" or empty to detect it from the header.
+func importSeparator(in *bufio.Reader, format string) (rune, error) {
+	switch format {
+	case "csv":
+		return ',', nil
+	case "tsv":
+		return '\t', nil
+	case "":
+		header, err := in.Peek(in.Size())
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return 0, fmt.Errorf("failed to read header: %v", err)
+		}
+		if i := strings.IndexByte(string(header), '\n'); i >= 0 {
+			header = header[:i]
+		}
+		if strings.Count(string(header), "\t") > strings.Count(string(header), ",") {
+			return '\t', nil
+		}
+		return ',', nil
+	}
+	return 0, fmt.Errorf("unknown format '%s', use 'csv' or 'tsv'", format)
+}
+
+func parseImportHeader(header []string) (importColumns, error) {
+	columns := importColumns{-1, -1, -1, -1}
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "phrase":
+			columns.phrase = i
+		case "explanation":
+			columns.explanation = i
+		case "tags":
+			columns.tags = i
+		case "alternatives":
+			columns.alternatives = i
+		}
+	}
+	if columns.phrase < 0 || columns.explanation < 0 {
+		return columns, fmt.Errorf("header needs columns 'phrase' and 'explanation', got %v", header)
+	}
+	return columns, nil
+}
+
+// Get the phrase of a row.
+// The reason is set if the row is invalid.
+func (c importColumns) parse(record []string) (brain.Phrase, string) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	p := brain.Phrase{
+		Phrase:      field(c.phrase),
+		Explanation: field(c.explanation),
+	}
+	for _, alt := range strings.Split(field(c.alternatives), brain.AlternativesSeparator) {
+		if alt = strings.TrimSpace(alt); alt != "" {
+			p.Alternatives = append(p.Alternatives, alt)
+		}
+	}
+	// Tags are separated by spaces like in Anki or by commas
+	p.Tags = strings.FieldsFunc(field(c.tags), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if p.Phrase == "" {
+		return p, "phrase is empty"
+	}
+	if p.Explanation == "" {
+		return p, "explanation is empty"
+	}
+	return p, ""
+}
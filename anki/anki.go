@@ -0,0 +1,363 @@
+// Package anki reads Anki deck packages (.apkg files) as phrases.
+//
+// A package is a zip file containing the collection as SQLite database and the media files.
+// Media files are not imported.
+// Packages exported by Anki 2.1.50 or later only contain a compressed collection
+// unless "Support older Anki versions" is checked when exporting.
+package anki
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorinvo/studybot/brain"
+)
+
+// Collection files in the order they are preferred
+var collectionFiles = []string{"collection.anki21", "collection.anki2"}
+
+// Only contained in packages of new Anki versions
+const compressedCollection = "collection.anki21b"
+
+// Maximum size of an unpacked collection in bytes.
+// Protects against packages that unpack to huge files.
+const maxCollectionSize = 512 << 20
+
+// Fields are the names of the note fields that are mapped to phrases.
+// Names are compared ignoring case.
+// If a note type has no field with the name,
+// its first field is used as explanation and its second field as phrase.
+// Cloze notes always use the text as phrase and the extra field as explanation.
+type Fields struct {
+	Phrase      string
+	Explanation string
+}
+
+// DefaultFields map notes of the note type Basic like the Anki export of Studybot:
+// the front is the explanation and the back is the phrase.
+var DefaultFields = Fields{Phrase: "Back", Explanation: "Front"}
+
+// ParseFields reads a mapping like "phrase=Back,explanation=Front".
+// Missing keys are taken from DefaultFields.
+func ParseFields(s string) (Fields, error) {
+	f := DefaultFields
+	if strings.TrimSpace(s) == "" {
+		return f, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+			return f, fmt.Errorf("invalid field mapping '%s', expected key=field", pair)
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "phrase":
+			f.Phrase = strings.TrimSpace(kv[1])
+		case "explanation":
+			f.Explanation = strings.TrimSpace(kv[1])
+		default:
+			return f, fmt.Errorf("unknown key '%s' in field mapping, use 'phrase' or 'explanation'", kv[0])
+		}
+	}
+	return f, nil
+}
+
+// Options configure how notes are converted to phrases.
+type Options struct {
+	Fields Fields
+	// Schedule is true if the intervals of studied cards are kept.
+	Schedule bool
+}
+
+// MapFields is an option to set which note fields are used for phrases.
+// DefaultFields are used by default.
+func MapFields(f Fields) func(*Options) {
+	return func(o *Options) {
+		o.Fields = f
+	}
+}
+
+// KeepSchedule is an option to keep the intervals of cards Anki schedules as reviews.
+// They are due at the same day as in Anki.
+// Without it, and for cards that are new or still in learning,
+// phrases are studied like newly added ones.
+func KeepSchedule(o *Options) {
+	o.Schedule = true
+}
+
+// Note is an Anki note converted to a phrase.
+type Note struct {
+	// ID is the ID of the note in Anki.
+	ID     int64
+	Phrase brain.Phrase
+	// Err is set if the note cannot be imported.
+	Err error
+}
+
+// Note type as stored in the models column of the collection
+type model struct {
+	Type   int
+	Fields []struct {
+		Name string
+		Ord  int
+	} `json:"flds"`
+}
+
+// Note type kinds
+const (
+	modelStandard = 0
+	modelCloze    = 1
+)
+
+// Card types
+const (
+	cardReview = 2
+)
+
+// Card queues
+const (
+	queueSuspended = -1
+)
+
+type card struct {
+	ord, cardType, queue int
+	// Day number relative to the collection creation for review cards
+	due int64
+	// Interval in days for review cards
+	interval, factor, reps, lapses int
+}
+
+// Read converts all notes of a .apkg file to phrases in the order they have been added.
+func Read(data []byte, options ...func(*Options)) ([]Note, error) {
+	o := Options{Fields: DefaultFields}
+	for _, option := range options {
+		option(&o)
+	}
+	collection, err := readCollection(data)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openSQLite(collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open collection: %v", err)
+	}
+
+	cols, err := db.table("col")
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) != 1 {
+		return nil, fmt.Errorf("expected 1 row in table col, got %d", len(cols))
+	}
+	// Columns id, crt, mod, scm, ver, dty, usn, ls, conf, models, ...
+	created := time.Unix(cols[0].int(1), 0)
+	var models map[string]model
+	if err := json.Unmarshal([]byte(cols[0].text(9)), &models); err != nil {
+		return nil, fmt.Errorf("failed to read note types: %v", err)
+	}
+
+	cardRows, err := db.table("cards")
+	if err != nil {
+		return nil, err
+	}
+	// Columns id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, ...
+	cards := map[int64][]card{}
+	for _, r := range cardRows {
+		nid := r.int(1)
+		cards[nid] = append(cards[nid], card{
+			ord:      int(r.int(3)),
+			cardType: int(r.int(6)),
+			queue:    int(r.int(7)),
+			due:      r.int(8),
+			interval: int(r.int(9)),
+			factor:   int(r.int(10)),
+			reps:     int(r.int(11)),
+			lapses:   int(r.int(12)),
+		})
+	}
+
+	noteRows, err := db.table("notes")
+	if err != nil {
+		return nil, err
+	}
+	// The ID is the creation time
+	sort.Slice(noteRows, func(i, j int) bool { return noteRows[i].rowid < noteRows[j].rowid })
+	var notes []Note
+	// Columns id, guid, mid, mod, usn, tags, flds, ...
+	for _, r := range noteRows {
+		n := Note{ID: r.rowid}
+		m, ok := models[strconv.FormatInt(r.int(2), 10)]
+		if !ok {
+			n.Err = fmt.Errorf("unknown note type %d", r.int(2))
+			notes = append(notes, n)
+			continue
+		}
+		n.Phrase, n.Err = m.phrase(strings.Split(r.text(6), "\x1f"), o.Fields)
+		n.Phrase.Tags = strings.Fields(r.text(5))
+		if n.Err == nil && o.Schedule {
+			schedule(&n.Phrase, cards[n.ID], created)
+		}
+		notes = append(notes, n)
+	}
+	return notes, nil
+}
+
+// Get the collection database of a package.
+func readCollection(data []byte) ([]byte, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+	// New packages contain a legacy collection with a single note
+	// asking to update Anki.
+	if _, ok := files[collectionFiles[0]]; !ok && files[compressedCollection] != nil {
+		return nil, errors.New("package has been exported for Anki 2.1.50 or later only; " +
+			"export it again with \"Support older Anki versions\" checked")
+	}
+	for _, name := range collectionFiles {
+		f, ok := files[name]
+		if !ok {
+			continue
+		}
+		if f.UncompressedSize64 > maxCollectionSize {
+			return nil, fmt.Errorf("%s is larger than %d MB", name, maxCollectionSize>>20)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", name, err)
+		}
+		defer r.Close()
+		// The size in the zip header might be wrong
+		b, err := ioutil.ReadAll(io.LimitReader(r, maxCollectionSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		if len(b) > maxCollectionSize {
+			return nil, fmt.Errorf("%s is larger than %d MB", name, maxCollectionSize>>20)
+		}
+		return b, nil
+	}
+	return nil, errors.New("package contains no collection")
+}
+
+// Convert the fields of a note of the model to a phrase.
+func (m model) phrase(fields []string, mapping Fields) (brain.Phrase, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(fields) {
+			return ""
+		}
+		return plainText(fields[i])
+	}
+	var p brain.Phrase
+	if m.Type == modelCloze {
+		p = brain.Phrase{Phrase: field(0), Explanation: field(1), Cloze: true}
+		if p.Phrase == "" {
+			return p, errors.New("text is empty")
+		}
+		return p, nil
+	}
+	p = brain.Phrase{
+		Phrase:      field(m.fieldIndex(mapping.Phrase, 1)),
+		Explanation: field(m.fieldIndex(mapping.Explanation, 0)),
+	}
+	if p.Phrase == "" {
+		return p, errors.New("phrase is empty")
+	}
+	if p.Explanation == "" {
+		return p, errors.New("explanation is empty")
+	}
+	return p, nil
+}
+
+// Get the index of the field with the given name or the fallback if there is none.
+func (m model) fieldIndex(name string, fallback int) int {
+	for _, f := range m.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Ord
+		}
+	}
+	return fallback
+}
+
+var (
+	htmlBreak = regexp.MustCompile(`(?i)<br\s*/?>|</div>|</p>|</li>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+	soundTag  = regexp.MustCompile(`\[sound:[^\]]*\]`)
+)
+
+// Convert an HTML field to plain text.
+// Line breaks are kept while images and sounds are removed.
+func plainText(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = soundTag.ReplaceAllString(s, "")
+	s = strings.Replace(html.UnescapeString(s), "\u00a0", " ", -1)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Set the review states of a phrase from the cards of its note.
+// Only cards in review are taken over.
+// The phrase is suspended if all its cards are suspended.
+func schedule(p *brain.Phrase, cards []card, created time.Time) {
+	suspended := len(cards) > 0
+	for _, c := range cards {
+		suspended = suspended && c.queue == queueSuspended
+		p.Lapses += c.lapses
+		if c.cardType != cardReview || c.interval <= 0 {
+			continue
+		}
+		interval := time.Duration(c.interval) * 24 * time.Hour
+		due := created.Add(time.Duration(c.due) * 24 * time.Hour)
+		state := brain.ReviewState{
+			Score:    exponentialScore(interval),
+			Reviewed: due.Add(-interval),
+			Interval: interval,
+			Ease:     float64(c.factor) / 1000,
+		}
+		// Anki counts all reviews, SM-2 only the ones since the last lapse
+		if c.reps > c.lapses {
+			state.Repetitions = c.reps - c.lapses
+		}
+		switch {
+		case p.Cloze:
+			if p.Clozes == nil {
+				p.Clozes = map[int]*brain.ReviewState{}
+			}
+			p.Clozes[c.ord+1] = &state
+		case c.ord == 0:
+			p.ReviewState = state
+		case c.ord == 1:
+			p.Reverse = &state
+		}
+	}
+	p.Suspended = suspended
+}
+
+// Get the score at which the exponential scheduler uses about the given interval.
+// It doubles the interval for each point starting with 6 hours.
+func exponentialScore(interval time.Duration) int {
+	score := int(math.Round(math.Log2(interval.Hours() / 6)))
+	if score < 1 {
+		return 1
+	}
+	return score
+}
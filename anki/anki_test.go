@@ -0,0 +1,397 @@
+package anki
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorinvo/studybot/brain"
+)
+
+// The fixtures are created by testdata/generate.py.
+func readFixture(t *testing.T, name string, options ...func(*Options)) []Note {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := Read(data, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notes
+}
+
+func TestReadBasic(t *testing.T) {
+	notes := readFixture(t, "basic.apkg")
+	// 5 notes and 40 more to fill several pages
+	if len(notes) != 45 {
+		t.Fatalf("expected 45 notes, got %d", len(notes))
+	}
+	tests := []struct {
+		id          int64
+		phrase      string
+		explanation string
+		tags        []string
+		err         string
+	}{
+		{1, "hallo du", "hello\nthere you", []string{"greeting"}, ""},
+		{2, "Katze", "cat", []string{}, ""},
+		{3, "nur Bild", "", []string{}, "explanation is empty"},
+		// No fields named like the default fields
+		{4, "tree", "Baum", []string{"nature", "plants"}, ""},
+		{100, "back 0", "front 0", []string{"bulk"}, ""},
+		{139, "back 39", "front 39", []string{"bulk"}, ""},
+	}
+	byID := map[int64]Note{}
+	for _, n := range notes {
+		byID[n.ID] = n
+	}
+	for _, test := range tests {
+		n, ok := byID[test.id]
+		if !ok {
+			t.Errorf("note %d not found", test.id)
+			continue
+		}
+		if test.err != "" {
+			if n.Err == nil || n.Err.Error() != test.err {
+				t.Errorf("note %d: expected error '%s', got %v", test.id, test.err, n.Err)
+			}
+			continue
+		}
+		if n.Err != nil {
+			t.Errorf("note %d: unexpected error %v", test.id, n.Err)
+			continue
+		}
+		p := n.Phrase
+		if p.Phrase != test.phrase || p.Explanation != test.explanation || p.Cloze {
+			t.Errorf("note %d: unexpected phrase %+v", test.id, p)
+		}
+		if len(p.Tags) != len(test.tags) || (len(p.Tags) > 0 && !reflect.DeepEqual(p.Tags, test.tags)) {
+			t.Errorf("note %d: expected tags %v, got %v", test.id, test.tags, p.Tags)
+		}
+		if p.ReviewState != (brain.ReviewState{}) || p.Reverse != nil || p.Suspended {
+			t.Errorf("note %d: expected no schedule without KeepSchedule, got %+v", test.id, p)
+		}
+	}
+
+	// Stored in overflow pages
+	if p := byID[5].Phrase; p.Explanation != "long" || p.Phrase != "lang "+strings.Repeat("x", 3000) {
+		t.Errorf("unexpected long phrase with explanation '%s' and %d characters", p.Explanation, len(p.Phrase))
+	}
+	for i := 1; i < len(notes); i++ {
+		if notes[i-1].ID >= notes[i].ID {
+			t.Fatalf("expected notes ordered by ID, got %d before %d", notes[i-1].ID, notes[i].ID)
+		}
+	}
+}
+
+func TestReadMapFields(t *testing.T) {
+	notes := readFixture(t, "basic.apkg", MapFields(Fields{Phrase: "word", Explanation: "Meaning"}))
+	if p := notes[3].Phrase; notes[3].ID != 4 || p.Phrase != "Baum" || p.Explanation != "tree" {
+		t.Errorf("expected mapped fields of note 4, got %+v", notes[3])
+	}
+	// Note types without the fields use the first two fields
+	if p := notes[0].Phrase; p.Phrase != "hallo du" || p.Explanation != "hello\nthere you" {
+		t.Errorf("expected fallback fields of note 1, got %+v", notes[0])
+	}
+}
+
+func TestReadCloze(t *testing.T) {
+	notes := readFixture(t, "cloze.apkg")
+	if len(notes) != 3 {
+		t.Fatalf("expected 3 notes, got %d", len(notes))
+	}
+	if p := notes[0].Phrase; notes[0].Err != nil || !p.Cloze ||
+		p.Phrase != "Ich {{c1::bin}} {{c2::müde}}" || p.Explanation != "I am tired" ||
+		!reflect.DeepEqual(p.Tags, []string{"grammar"}) {
+		t.Errorf("unexpected cloze %+v: %v", p, notes[0].Err)
+	}
+	if p := notes[1].Phrase; notes[1].Err != nil || !p.Cloze || p.Phrase != "{{c1::Hola}}" || p.Explanation != "" {
+		t.Errorf("expected cloze without extra, got %+v: %v", p, notes[1].Err)
+	}
+	if notes[2].Err == nil || notes[2].Err.Error() != "text is empty" {
+		t.Errorf("expected empty text to fail, got %v", notes[2].Err)
+	}
+}
+
+func TestReadSchedule(t *testing.T) {
+	notes := readFixture(t, "scheduled.apkg", KeepSchedule)
+	if len(notes) != 5 {
+		t.Fatalf("expected 5 notes, got %d", len(notes))
+	}
+	// See CREATED in testdata/generate.py
+	created := time.Unix(1600000000, 0)
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	review := func(due, interval int, ease float64, repetitions, score int) brain.ReviewState {
+		return brain.ReviewState{
+			Score:       score,
+			Reviewed:    created.Add(days(due - interval)),
+			Interval:    days(interval),
+			Ease:        ease,
+			Repetitions: repetitions,
+		}
+	}
+
+	if p := notes[0].Phrase; !equalState(p.ReviewState, review(100, 10, 2.5, 4, 5)) || p.Lapses != 1 || p.Suspended {
+		t.Errorf("unexpected review card %+v", p)
+	}
+	if p := notes[1].Phrase; !equalState(p.ReviewState, review(101, 4, 2.3, 3, 4)) || p.Reverse != nil {
+		t.Errorf("expected only the forward card to be scheduled, got %+v", p)
+	}
+	p := notes[2].Phrase
+	if p.ReviewState != (brain.ReviewState{}) || len(p.Clozes) != 1 || p.Clozes[1] == nil || p.Lapses != 2 {
+		t.Fatalf("expected only the first cloze to be scheduled, got %+v", p)
+	}
+	if !equalState(*p.Clozes[1], review(130, 60, 2.6, 6, 8)) {
+		t.Errorf("unexpected cloze state %+v", *p.Clozes[1])
+	}
+	if p := notes[3].Phrase; !p.Suspended || p.Lapses != 3 {
+		t.Errorf("expected suspended phrase, got %+v", p)
+	}
+	if p := notes[4].Phrase; p.ReviewState != (brain.ReviewState{}) || p.Lapses != 0 {
+		t.Errorf("expected new phrase without schedule, got %+v", p)
+	}
+
+	// The schedule is only kept with KeepSchedule
+	for _, n := range readFixture(t, "scheduled.apkg") {
+		if n.Phrase.ReviewState != (brain.ReviewState{}) || n.Phrase.Clozes != nil || n.Phrase.Suspended {
+			t.Errorf("expected no schedule for note %d, got %+v", n.ID, n.Phrase)
+		}
+	}
+}
+
+func equalState(a, b brain.ReviewState) bool {
+	return a.Reviewed.Equal(b.Reviewed) && a.Score == b.Score && a.Interval == b.Interval &&
+		a.Ease == b.Ease && a.Repetitions == b.Repetitions
+}
+
+func TestReadCompressedOnly(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "anki21b.apkg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Read(data)
+	if err == nil || !strings.Contains(err.Error(), "Support older Anki versions") {
+		t.Errorf("expected error asking to export for older versions, got %v", err)
+	}
+	if _, err := Read([]byte("not a zip")); err == nil {
+		t.Error("expected error for invalid package")
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Fields
+		err bool
+	}{
+		{"", DefaultFields, false},
+		{"phrase=Word", Fields{Phrase: "Word", Explanation: "Front"}, false},
+		{" explanation = Meaning , phrase=Word", Fields{Phrase: "Word", Explanation: "Meaning"}, false},
+		{"phrase", DefaultFields, true},
+		{"phrase=", DefaultFields, true},
+		{"front=Word", DefaultFields, true},
+	}
+	for _, test := range tests {
+		f, err := ParseFields(test.in)
+		if (err != nil) != test.err || (!test.err && f != test.out) {
+			t.Errorf("ParseFields(%q) = %+v, %v", test.in, f, err)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"plain", "plain"},
+		{"<b>bold</b> &amp; <i>more</i>", "bold & more"},
+		{"one<br>two<BR/>three", "one\ntwo\nthree"},
+		{"<div>a</div><div> b </div>", "a\nb"},
+		{"word&nbsp;word", "word word"},
+		{"hear [sound:x.mp3]<img src=\"y.jpg\">", "hear"},
+	}
+	for _, test := range tests {
+		if got := plainText(test.in); got != test.out {
+			t.Errorf("plainText(%q) = %q, expected %q", test.in, got, test.out)
+		}
+	}
+}
+
+func TestExponentialScore(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		score    int
+	}{
+		{time.Hour, 1},
+		{12 * time.Hour, 1},
+		{24 * time.Hour, 2},
+		{10 * 24 * time.Hour, 5},
+		{60 * 24 * time.Hour, 8},
+	}
+	for _, test := range tests {
+		if got := exponentialScore(test.interval); got != test.score {
+			t.Errorf("exponentialScore(%s) = %d, expected %d", test.interval, got, test.score)
+		}
+	}
+}
+
+// Build a SQLite file with 512 byte pages from the content of the pages.
+// The content of the first page starts after the file header.
+func sqliteFile(pages ...[]byte) []byte {
+	data := make([]byte, 512*len(pages))
+	copy(data, sqliteMagic)
+	binary.BigEndian.PutUint16(data[16:18], 512)
+	binary.BigEndian.PutUint32(data[56:60], 1)
+	for i, p := range pages {
+		start := i * 512
+		if i == 0 {
+			start = 100
+		}
+		copy(data[start:(i+1)*512], p)
+	}
+	return data
+}
+
+// Build a leaf table page with the given cells.
+// offset is the position of the page content in the page.
+func leafPage(offset int, cells ...[]byte) []byte {
+	page := make([]byte, 512-offset)
+	page[0] = pageLeafTable
+	binary.BigEndian.PutUint16(page[3:5], uint16(len(cells)))
+	end := len(page)
+	for i, c := range cells {
+		end -= len(c)
+		copy(page[end:], c)
+		binary.BigEndian.PutUint16(page[8+2*i:], uint16(end+offset))
+	}
+	return page
+}
+
+// Build a cell with a record of small integers and short strings.
+func recordCell(rowid int, values ...interface{}) []byte {
+	header := []byte{0}
+	var body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case int:
+			header = append(header, 1)
+			body = append(body, byte(v))
+		case string:
+			header = append(header, byte(13+2*len(v)))
+			body = append(body, v...)
+		}
+	}
+	header[0] = byte(len(header))
+	record := append(header, body...)
+	return append([]byte{byte(len(record)), byte(rowid)}, record...)
+}
+
+// Schema page with a table t stored at page 2
+var schemaPage = leafPage(100, recordCell(1, "table", "t", "t", 2, "CREATE TABLE t (a)"))
+
+func TestSQLite(t *testing.T) {
+	data := sqliteFile(schemaPage, leafPage(0, recordCell(1, "a"), recordCell(2, 7)))
+	db, err := openSQLite(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.table("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].rowid != 1 || rows[0].text(0) != "a" || rows[1].int(0) != 7 {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+	if _, err := db.table("missing"); err == nil {
+		t.Error("expected error for missing table")
+	}
+}
+
+func TestSQLiteCorrupt(t *testing.T) {
+	// Interior page pointing to itself
+	loop := make([]byte, 512)
+	loop[0] = pageInteriorTable
+	binary.BigEndian.PutUint32(loop[8:12], 2)
+	// More cells than fit into the page
+	tooManyCells := leafPage(0)
+	binary.BigEndian.PutUint16(tooManyCells[3:5], 0xffff)
+	// Payload larger than the file
+	hugePayload := leafPage(0, []byte{0x84, 0x80, 0x80, 0x80, 0x00, 1, 2, 1, 1})
+	// Header size smaller than its own varint
+	shortHeader := leafPage(0, []byte{2, 1, 0, 0})
+	// Negative header size
+	negativeHeader := leafPage(0, append([]byte{10, 1}, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0))
+
+	tests := []struct {
+		name string
+		page []byte
+	}{
+		{"loop", loop},
+		{"too many cells", tooManyCells},
+		{"huge payload", hugePayload},
+		{"short header", shortHeader},
+		{"negative header", negativeHeader},
+	}
+	for _, test := range tests {
+		db, err := openSQLite(sqliteFile(schemaPage, test.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.table("t"); err == nil || !strings.Contains(err.Error(), errCorrupt.Error()) {
+			t.Errorf("%s: expected corrupt database, got %v", test.name, err)
+		}
+	}
+
+	// Reserved bytes leaving too little space per page
+	data := sqliteFile(schemaPage)
+	data[20] = 100
+	if _, err := openSQLite(data); err != errCorrupt {
+		t.Errorf("expected corrupt database for unusable page size, got %v", err)
+	}
+}
+
+// Changed bytes in a collection must lead to errors, never to a crash.
+func TestSQLiteMutations(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "basic.apkg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := readCollection(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		mutated := append([]byte(nil), collection...)
+		for j := 0; j < 1+r.Intn(4); j++ {
+			mutated[r.Intn(len(mutated))] = byte(r.Intn(256))
+		}
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					t.Fatalf("mutation %d: panic: %v", i, v)
+				}
+			}()
+			readTables(mutated)
+		}()
+	}
+}
+
+func readTables(data []byte) error {
+	db, err := openSQLite(data)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"col", "notes", "cards"} {
+		if _, err := db.table(name); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
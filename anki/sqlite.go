@@ -0,0 +1,337 @@
+package anki
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// A minimal reader for SQLite database files.
+// It only supports what is needed to read the tables of an Anki collection:
+// full scans of tables in UTF-8 encoded databases.
+// See https://www.sqlite.org/fileformat.html
+
+const sqliteMagic = "SQLite format 3\x00"
+
+// B-tree page types
+const (
+	pageInteriorTable = 0x05
+	pageLeafTable     = 0x0d
+)
+
+var errCorrupt = errors.New("database file is corrupt")
+
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	// Page size without the reserved bytes at the end of each page
+	usable int
+}
+
+// A row of a table.
+// Columns declared as INTEGER PRIMARY KEY are NULL in values
+// since their value is the rowid.
+type sqliteRow struct {
+	rowid  int64
+	values []interface{}
+}
+
+func openSQLite(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteMagic {
+		return nil, errors.New("not a SQLite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || len(data)%pageSize != 0 {
+		return nil, errCorrupt
+	}
+	if encoding := binary.BigEndian.Uint32(data[56:60]); encoding > 1 {
+		return nil, fmt.Errorf("unsupported text encoding %d", encoding)
+	}
+	// The usable size must be at least 480 bytes
+	usable := pageSize - int(data[20])
+	if usable < 480 {
+		return nil, errCorrupt
+	}
+	return &sqliteDB{data: data, pageSize: pageSize, usable: usable}, nil
+}
+
+func (db *sqliteDB) page(n int) ([]byte, error) {
+	if n < 1 || n*db.pageSize > len(db.data) {
+		return nil, errCorrupt
+	}
+	return db.data[(n-1)*db.pageSize : n*db.pageSize], nil
+}
+
+// Read all rows of the table with the given name.
+func (db *sqliteDB) table(name string) ([]sqliteRow, error) {
+	// The schema table is stored at page 1
+	// with the columns type, name, tbl_name, rootpage and sql.
+	schema, err := db.scan(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %v", err)
+	}
+	for _, row := range schema {
+		if len(row.values) < 4 || row.values[0] != "table" || row.values[1] != name {
+			continue
+		}
+		root, ok := row.values[3].(int64)
+		if !ok {
+			return nil, errCorrupt
+		}
+		rows, err := db.scan(int(root))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table %s: %v", name, err)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("table %s not found", name)
+}
+
+// Read all rows of the table b-tree with the given root page.
+func (db *sqliteDB) scan(root int) ([]sqliteRow, error) {
+	var rows []sqliteRow
+	// Pages still to read
+	pages := []int{root}
+	// Each page is read once; guards against cycles in corrupt files
+	visited := map[int]bool{}
+	for len(pages) > 0 {
+		n := pages[len(pages)-1]
+		pages = pages[:len(pages)-1]
+		if visited[n] {
+			return nil, errCorrupt
+		}
+		visited[n] = true
+		page, err := db.page(n)
+		if err != nil {
+			return nil, err
+		}
+		// The first page starts with the file header
+		header := page
+		if n == 1 {
+			header = page[100:]
+		}
+		cells := int(binary.BigEndian.Uint16(header[3:5]))
+		switch header[0] {
+		case pageInteriorTable:
+			// The header is followed by the array of cell pointers
+			if 12+2*cells > len(header) {
+				return nil, errCorrupt
+			}
+			// Push children in reverse order to read rows in order
+			pages = append(pages, int(binary.BigEndian.Uint32(header[8:12])))
+			for i := cells - 1; i >= 0; i-- {
+				offset := int(binary.BigEndian.Uint16(header[12+2*i:]))
+				if offset+4 > len(page) {
+					return nil, errCorrupt
+				}
+				pages = append(pages, int(binary.BigEndian.Uint32(page[offset:])))
+			}
+		case pageLeafTable:
+			if 8+2*cells > len(header) {
+				return nil, errCorrupt
+			}
+			for i := 0; i < cells; i++ {
+				offset := int(binary.BigEndian.Uint16(header[8+2*i:]))
+				row, err := db.leafCell(page, offset)
+				if err != nil {
+					return nil, err
+				}
+				rows = append(rows, row)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected page type %d", header[0])
+		}
+	}
+	return rows, nil
+}
+
+// Read the cell of a table leaf page at the given offset.
+func (db *sqliteDB) leafCell(page []byte, offset int) (sqliteRow, error) {
+	if offset >= len(page) {
+		return sqliteRow{}, errCorrupt
+	}
+	size, n := sqliteVarint(page[offset:])
+	if n == 0 {
+		return sqliteRow{}, errCorrupt
+	}
+	offset += n
+	rowid, n := sqliteVarint(page[offset:])
+	if n == 0 {
+		return sqliteRow{}, errCorrupt
+	}
+	offset += n
+	// A payload can't be larger than the database
+	if size < 0 || size > int64(len(db.data)) {
+		return sqliteRow{}, errCorrupt
+	}
+	payload, err := db.payload(page, offset, int(size))
+	if err != nil {
+		return sqliteRow{}, err
+	}
+	values, err := parseRecord(payload)
+	if err != nil {
+		return sqliteRow{}, err
+	}
+	return sqliteRow{rowid: rowid, values: values}, nil
+}
+
+// Read a payload of the given size starting in a page at the given offset.
+// Payloads that don't fit into the page continue in a list of overflow pages.
+func (db *sqliteDB) payload(page []byte, offset, size int) ([]byte, error) {
+	u := db.usable
+	local := size
+	if maxLocal := u - 35; size > maxLocal {
+		minLocal := (u-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if offset+local > len(page) || size < 0 {
+		return nil, errCorrupt
+	}
+	if local == size {
+		return page[offset : offset+size], nil
+	}
+	if offset+local+4 > len(page) {
+		return nil, errCorrupt
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, page[offset:offset+local]...)
+	next := int(binary.BigEndian.Uint32(page[offset+local:]))
+	for len(payload) < size {
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(overflow))
+		chunk := overflow[4:u]
+		if rest := size - len(payload); len(chunk) > rest {
+			chunk = chunk[:rest]
+		}
+		payload = append(payload, chunk...)
+	}
+	return payload, nil
+}
+
+// Decode the values of a record.
+func parseRecord(b []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(b)
+	if n == 0 || headerSize < int64(n) || headerSize > int64(len(b)) {
+		return nil, errCorrupt
+	}
+	header := b[n:headerSize]
+	body := b[headerSize:]
+	var values []interface{}
+	for len(header) > 0 {
+		serialType, n := sqliteVarint(header)
+		if n == 0 || serialType < 0 {
+			return nil, errCorrupt
+		}
+		header = header[n:]
+		size := serialSize(serialType)
+		if size > len(body) {
+			return nil, errCorrupt
+		}
+		v := body[:size]
+		body = body[size:]
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType <= 6:
+			values = append(values, sqliteInt(v))
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, v)
+		case serialType >= 13:
+			values = append(values, string(v))
+		default:
+			return nil, errCorrupt
+		}
+	}
+	return values, nil
+}
+
+// Size of the value of a serial type in bytes
+func serialSize(t int64) int {
+	switch {
+	case t >= 12:
+		return int((t - 12) / 2)
+	case t == 5:
+		return 6
+	case t == 6 || t == 7:
+		return 8
+	case t >= 1 && t <= 4:
+		return int(t)
+	}
+	return 0
+}
+
+// Decode a big-endian two's complement integer of 1 to 8 bytes.
+func sqliteInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// Decode a SQLite varint of 1 to 9 bytes.
+// Returns the value and the number of bytes read; 0 if b is too short.
+func sqliteVarint(b []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		if i == 8 {
+			return int64(v<<8 | uint64(b[i])), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	return int64(v), 9
+}
+
+// Get a column of a row as string; blobs are converted.
+func (r sqliteRow) text(i int) string {
+	if i >= len(r.values) {
+		return ""
+	}
+	switch v := r.values[i].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(bytes.TrimRight(v, "\x00"))
+	}
+	return ""
+}
+
+// Get a column of a row as integer; floats are truncated.
+func (r sqliteRow) int(i int) int64 {
+	if i >= len(r.values) {
+		return 0
+	}
+	switch v := r.values[i].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+#!/usr/bin/env python3
+# Generates the .apkg fixtures of the anki package tests.
+# The collections are written by SQLite with the schema of Anki 2.1 collections.
+# Run it in this directory: python3 generate.py
+import json
+import os
+import sqlite3
+import tempfile
+import zipfile
+
+SCHEMA = """
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+"""
+
+MODELS = {
+    "1000": {"name": "Basic", "type": 0, "flds": [{"name": "Front", "ord": 0}, {"name": "Back", "ord": 1}]},
+    "2000": {"name": "Basic (and reversed card)", "type": 0, "flds": [{"name": "Front", "ord": 0}, {"name": "Back", "ord": 1}]},
+    "3000": {"name": "Cloze", "type": 1, "flds": [{"name": "Text", "ord": 0}, {"name": "Back Extra", "ord": 1}]},
+    "4000": {"name": "Vocab", "type": 0, "flds": [{"name": "Word", "ord": 0}, {"name": "Meaning", "ord": 1}, {"name": "Example", "ord": 2}]},
+}
+
+# Collection creation time; due days of review cards are relative to it
+CREATED = 1600000000
+
+
+def collection(notes, page_size=4096):
+    """Create a collection with notes of (id, model, tags, fields, cards).
+    Cards are (ord, type, queue, due, ivl, factor, reps, lapses)."""
+    fd, path = tempfile.mkstemp()
+    os.close(fd)
+    os.remove(path)
+    db = sqlite3.connect(path)
+    db.execute("PRAGMA page_size=%d" % page_size)
+    db.executescript(SCHEMA)
+    db.execute("insert into col values (1,?,0,0,11,0,0,0,'{}',?,'{}','{}','{}')", (CREATED, json.dumps(MODELS)))
+    card_id = 1
+    for nid, mid, tags, fields, cards in notes:
+        db.execute("insert into notes values (?,?,?,0,0,?,?,'',0,0,'')",
+                   (nid, "g%d" % nid, mid, " %s " % tags if tags else "", "\x1f".join(fields)))
+        for card in cards:
+            db.execute("insert into cards values (?,?,1,?,0,0,?,?,?,?,?,?,?,0,0,0,0,'')", (card_id, nid) + card)
+            card_id += 1
+    db.commit()
+    db.close()
+    with open(path, "rb") as f:
+        data = f.read()
+    os.remove(path)
+    return data
+
+
+def package(name, files):
+    with zipfile.ZipFile(name, "w", zipfile.ZIP_DEFLATED) as z:
+        for filename, data in files + [("media", b"{}")]:
+            info = zipfile.ZipInfo(filename, (2020, 1, 1, 0, 0, 0))
+            info.compress_type = zipfile.ZIP_DEFLATED
+            z.writestr(info, data)
+
+
+NEW = (0, 0, 0, 1, 0, 0, 0, 0)
+
+# Basic note types exported with "Support older Anki versions".
+# Small pages and a long field make the collection use interior and overflow pages.
+basic = [
+    (1, 1000, "greeting", ["hello<br>there&nbsp;you", "hallo <b>du</b>"], [NEW]),
+    (2, 2000, "", ["cat", "Katze"], [NEW, (1, 0, 0, 2, 0, 0, 0, 0)]),
+    (3, 1000, "", ["<img src='x.jpg'>", "nur Bild"], [NEW]),
+    (4, 4000, "nature plants", ["Baum", "tree", "Der Baum ist grün"], [NEW]),
+    (5, 1000, "", ["long", "lang " + "x" * 3000], [NEW]),
+]
+for i in range(40):
+    basic.append((100 + i, 1000, "bulk", ["front %d" % i, "back %d" % i], [NEW]))
+package("basic.apkg", [("collection.anki2", collection(basic, page_size=512))])
+
+cloze = [
+    (1, 3000, "grammar", ["Ich {{c1::bin}} {{c2::müde}}", "I am tired"], [NEW, (1, 0, 0, 1, 0, 0, 0, 0)]),
+    (2, 3000, "", ["<div>{{c1::Hola}}</div>", ""], [NEW]),
+    (3, 3000, "", ["", "nothing to study"], [NEW]),
+]
+package("cloze.apkg", [("collection.anki21", collection(cloze))])
+
+scheduled = [
+    # Review card due on day 100, studied 10 days before
+    (1, 1000, "", ["hello", "hallo"], [(0, 2, 2, 100, 10, 2500, 5, 1)]),
+    # Only the forward card is in review
+    (2, 2000, "", ["cat", "Katze"], [(0, 2, 2, 101, 4, 2300, 3, 0), (1, 0, 0, 5, 0, 0, 0, 0)]),
+    # The second cloze is still in learning
+    (3, 3000, "", ["Ich {{c1::bin}} {{c2::müde}}", "I am tired"],
+     [(0, 2, 2, 130, 60, 2600, 8, 2), (1, 1, 1, CREATED, 0, 2500, 1, 0)]),
+    # Suspended review card
+    (4, 1000, "", ["dog", "Hund"], [(0, 2, -1, 102, 3, 2500, 4, 3)]),
+    (5, 1000, "", ["new", "neu"], [NEW]),
+]
+package("scheduled.apkg", [("collection.anki21", collection(scheduled))])
+
+# Anki 2.1.50 and later only export a compressed collection
+# together with a legacy collection asking to update Anki.
+legacy = [(1, 1000, "", ["Please update to the latest Anki version, then import the .colpkg/.apkg file again.", ""], [NEW])]
+package("anki21b.apkg", [("collection.anki21b", b"\x28\xb5\x2f\xfd compressed"), ("collection.anki2", collection(legacy))])
@@ -0,0 +1,156 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Backlog describes how the overdue studies of a chat have been spread.
+type Backlog struct {
+	// Overdue is the number of studies that were due.
+	Overdue int
+	// Today is the number of studies that are still due now.
+	Today int
+	// Days is the number of following days the other studies have been moved to.
+	// It is 0 if no study has been moved.
+	Days int
+}
+
+// An overdue card
+type backlogCard struct {
+	key      []byte
+	due      int64
+	priority float64
+}
+
+// SpreadBacklog limits the studies of a chat due at the given time to UserSettings.BacklogPerDay.
+// If more studies are due, the ones most likely forgotten stay due
+// and the others are moved to the following days, BacklogPerDay studies per day.
+// Studies in learning steps and studies forgotten last time stay due first.
+// Other studies are the more likely forgotten the larger the part of their interval they are overdue
+// and the younger they are.
+// This way mature phrases with long intervals and new phrases wait longest.
+// Only phrases of the decks the chat is studying are considered
+// and suspended phrases are skipped.
+// Phrases in the queue of new phrases are skipped too
+// since they are limited by UserSettings.NewPerDay.
+// The backlog is spread at most once a day in the timezone of the user;
+// later calls on the same day return an empty Backlog.
+func (store Bolt) SpreadBacklog(chatID int64, now time.Time) (Backlog, error) {
+	var backlog Backlog
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		settings, err := getUserSettings(tx, chatID)
+		if err != nil {
+			return err
+		}
+		bb := tx.Bucket(bucketBacklogs)
+		day := settings.day(now)
+		if string(bb.Get(itob(chatID))) == day {
+			return nil
+		}
+		if err := bb.Put(itob(chatID), []byte(day)); err != nil {
+			return err
+		}
+		bp := tx.Bucket(bucketPhrases)
+		due, err := newDueCursor(tx, chatID)
+		if err != nil {
+			return err
+		}
+		cards, err := backlogCards(due, now, func(key []byte) (Phrase, error) {
+			var p Phrase
+			err := json.Unmarshal(bp.Get(phraseKey(key)), &p)
+			return p, err
+		})
+		if err != nil {
+			return err
+		}
+		var moved []backlogCard
+		moved, backlog = spreadBacklog(cards, settings.BacklogPerDay, now)
+		for _, card := range moved {
+			if err := putStudytime(tx, card.key, card.due); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return backlog, fmt.Errorf("failed to spread backlog of chatID %d: %v", chatID, err)
+	}
+	return backlog, nil
+}
+
+// Get the overdue cards of the backlog with their priority.
+// getPhrase returns the phrase of a studytimes key.
+func backlogCards(due studyCursor, now time.Time, getPhrase func([]byte) (Phrase, error)) ([]backlogCard, error) {
+	var cards []backlogCard
+	for studyKey, timestamp := due.first(); studyKey != nil; studyKey, timestamp = due.next() {
+		if timestamp > now.Unix() {
+			break
+		}
+		p, err := getPhrase(studyKey)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, backlogCard{
+			key:      studyKey,
+			due:      timestamp,
+			priority: backlogPriority(p.cardState(studyKey), timestamp, now),
+		})
+	}
+	return cards, nil
+}
+
+// Cards with an interval of at least matureInterval are mature.
+const matureInterval = 21 * 24 * time.Hour
+
+// Get the priority of an overdue card; higher is studied earlier.
+// Cards in learning steps and cards forgotten at their latest study come first.
+// For other cards it's the part of the interval the card is overdue
+// plus up to 1 the younger the card is,
+// since young cards are forgotten faster than mature ones.
+// New cards have the lowest priority.
+func backlogPriority(state *ReviewState, due int64, now time.Time) float64 {
+	if state == nil || state.Reviewed.IsZero() {
+		return 0
+	}
+	if state.Step > 0 || state.Lapsed || state.Interval <= 0 {
+		return math.Inf(1)
+	}
+	overdue := float64(now.Unix()-due) / state.Interval.Seconds()
+	maturity := math.Min(state.Interval.Seconds()/matureInterval.Seconds(), 1)
+	return overdue + 1 - maturity
+}
+
+// Pick the overdue cards that don't fit into today and set their new study times.
+// The cards are spread over the following days by priority,
+// cards of the same priority by their study time.
+// Within a day they keep this order.
+func spreadBacklog(cards []backlogCard, perDay int, now time.Time) ([]backlogCard, Backlog) {
+	backlog := Backlog{Overdue: len(cards), Today: len(cards)}
+	if len(cards) <= perDay {
+		return nil, backlog
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		if cards[i].priority != cards[j].priority {
+			return cards[i].priority > cards[j].priority
+		}
+		if cards[i].due != cards[j].due {
+			return cards[i].due < cards[j].due
+		}
+		return bytes.Compare(cards[i].key, cards[j].key) < 0
+	})
+	backlog.Today = perDay
+	backlog.Days = (len(cards) - 1) / perDay
+	moved := cards[perDay:]
+	for i := range moved {
+		day := int64(i/perDay + 1)
+		moved[i].due = now.Unix() + day*24*60*60 + int64(i%perDay)
+	}
+	return moved, backlog
+}
@@ -0,0 +1,45 @@
+package brain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBacklogPriority(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	// Card with the given interval overdue by the given part of it
+	overdue := func(interval time.Duration, part float64) (*ReviewState, int64) {
+		late := time.Duration(part * float64(interval))
+		return &ReviewState{Score: 1, Reviewed: now.Add(-interval - late), Interval: interval}, now.Add(-late).Unix()
+	}
+	young, youngDue := overdue(2*day, 0.5)
+	mature, matureDue := overdue(60*day, 0.5)
+	veryLate, veryLateDue := overdue(60*day, 2)
+	learning := &ReviewState{Reviewed: now.Add(-time.Hour), Step: 1}
+	lapsed, lapsedDue := overdue(60*day, 0.1)
+	lapsed.Lapsed = true
+
+	// Ordered from highest to lowest priority
+	tests := []struct {
+		name     string
+		priority float64
+	}{
+		{"learning", backlogPriority(learning, now.Add(-time.Hour).Unix(), now)},
+		{"lapsed", backlogPriority(lapsed, lapsedDue, now)},
+		{"very late", backlogPriority(veryLate, veryLateDue, now)},
+		{"young", backlogPriority(young, youngDue, now)},
+		{"mature", backlogPriority(mature, matureDue, now)},
+		{"new", backlogPriority(&ReviewState{}, now.Unix(), now)},
+	}
+	for i := 1; i < len(tests); i++ {
+		prev, test := tests[i-1], tests[i]
+		// Learning and lapsed cards share the top priority
+		if test.priority > prev.priority || (test.priority == prev.priority && i > 1) {
+			t.Errorf("expected %s (%f) before %s (%f)", prev.name, prev.priority, test.name, test.priority)
+		}
+	}
+	if p := backlogPriority(nil, now.Unix(), now); p != 0 {
+		t.Errorf("expected new reverse cards to have no priority, got %f", p)
+	}
+}
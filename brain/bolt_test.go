@@ -0,0 +1,93 @@
+package brain_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/brain/storetest"
+)
+
+// Create a temporary directory and a function creating a new Bolt store in it for each call.
+// The returned function removes the directory.
+func newBolt(t testing.TB) (func(options ...func(*brain.Options)) brain.Store, func()) {
+	dir, err := ioutil.TempDir("", "studybot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := 0
+	return func(options ...func(*brain.Options)) brain.Store {
+			i++
+			store, err := brain.New(filepath.Join(dir, fmt.Sprintf("%d.db", i)), options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		}, func() {
+			if err := os.RemoveAll(dir); err != nil {
+				t.Error(err)
+			}
+		}
+}
+
+func TestBolt(t *testing.T) {
+	newStore, cleanup := newBolt(t)
+	defer cleanup()
+	storetest.Run(t, func() brain.Store { return newStore() })
+}
+
+func TestBoltOptions(t *testing.T) {
+	newStore, cleanup := newBolt(t)
+	defer cleanup()
+	storetest.RunOptions(t, newStore)
+}
+
+// Bolt store finding the current study without the due index
+type scanBolt struct {
+	*brain.Bolt
+}
+
+func (store scanBolt) GetStudy(chatID int64) (brain.Study, error) {
+	return store.ScanStudy(chatID)
+}
+
+func BenchmarkBoltGetStudy(b *testing.B) {
+	newStore, cleanup := newBolt(b)
+	defer cleanup()
+	storetest.BenchmarkGetStudy(b, func() brain.Store { return newStore() })
+}
+
+func BenchmarkBoltGetNotifyTime(b *testing.B) {
+	newStore, cleanup := newBolt(b)
+	defer cleanup()
+	storetest.BenchmarkGetNotifyTime(b, func() brain.Store { return newStore() })
+}
+
+func BenchmarkBoltGetStudySkipped(b *testing.B) {
+	newStore, cleanup := newBolt(b)
+	defer cleanup()
+	storetest.BenchmarkGetStudySkipped(b, func() brain.Store { return newStore() })
+}
+
+func BenchmarkBoltGetNotifyTimeSkipped(b *testing.B) {
+	newStore, cleanup := newBolt(b)
+	defer cleanup()
+	storetest.BenchmarkGetNotifyTimeSkipped(b, func() brain.Store { return newStore() })
+}
+
+// Baselines reading all study times of the chat
+
+func BenchmarkBoltScanGetStudy(b *testing.B) {
+	newStore, cleanup := newBolt(b)
+	defer cleanup()
+	storetest.BenchmarkGetStudy(b, func() brain.Store { return scanBolt{newStore().(*brain.Bolt)} })
+}
+
+func BenchmarkBoltScanGetStudySkipped(b *testing.B) {
+	newStore, cleanup := newBolt(b)
+	defer cleanup()
+	storetest.BenchmarkGetStudySkipped(b, func() brain.Store { return scanBolt{newStore().(*brain.Bolt)} })
+}
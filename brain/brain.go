@@ -15,14 +15,24 @@ const (
 	// somewhere between the new time and new time + studyTimeDiffusion
 	// to mix up the order in which words are studied.
 	studyTimeDiffusion = 30
-	// Maximum number of new studies per day
+	// Default maximum number of new studies per day
 	newPerDay = 30
-	// Minimum number of studies needed to be due before notifying user
+	// Default minimum number of studies needed to be due before notifying user
 	dueMinCount = 9
+	// Cards in learning due within this time are studied early
+	// if no other studies are due
+	learnAhead = 20 * time.Minute
 	// Time user has to be inactive before being notified
 	dueMinInactive = 10 * time.Minute
+	// Number of lapses after which a phrase is suspended
+	defaultLeechThreshold = 8
+	// Default maximum number of overdue studies per day when catching up
+	backlogPerDay = 50
 )
 
+// All buckets except bucketMeta store data of chats
+// and their keys must start with the chat ID.
+// This way DeleteChat can erase all data of a chat.
 var (
 	bucketModes         = []byte("modes")
 	bucketPhrases       = []byte("phrases")
@@ -30,6 +40,18 @@ var (
 	bucketReads         = []byte("reads")
 	bucketActivities    = []byte("activities")
 	bucketSubscriptions = []byte("subscriptions")
+	bucketReviews       = []byte("reviews")
+	bucketDecks         = []byte("decks")
+	bucketDeckSettings  = []byte("decksettings")
+	bucketUndos         = []byte("undos")
+	bucketMeta          = []byte("meta")
+	bucketDue           = []byte("due")
+	bucketDeckDue       = []byte("deckdue")
+	bucketSettings      = []byte("settings")
+	bucketPauses        = []byte("pauses")
+	bucketNewQueue      = []byte("newqueue")
+	bucketNewCounts     = []byte("newcounts")
+	bucketBacklogs      = []byte("backlogs")
 )
 
 // Mode is the state of a chat.
@@ -47,12 +69,26 @@ const (
 	ModeGetStarted
 	// ModeFeedback allows the user to send a message that is ready by a human.
 	ModeFeedback
+	// ModeAddDeck lets the user send the name of a new deck.
+	ModeAddDeck
+	// ModeRenameDeck lets the user send a new name for the current deck.
+	ModeRenameDeck
+	// ModeEditPhrase lets the user correct the phrase currently studied.
+	ModeEditPhrase
+	// ModeQuiz goes to phrases ready to study and offers multiple choices as answers.
+	ModeQuiz
+	// ModeEditLeech lets the user correct the phrase that has just been suspended.
+	ModeEditLeech
 )
 
 // Study is a study the current study the user needs to answer.
 type Study struct {
+	// PhraseID identifies the phrase of the study.
+	PhraseID int64
 	// Phrase is the phrase the user needs to guess.
 	Phrase string
+	// Alternatives are other accepted answers besides Phrase.
+	Alternatives []string
 	// Explanation is the explanation displayed to the user.
 	Explanation string
 	// Total is the total number of studies ready, including the current one.
@@ -60,11 +96,43 @@ type Study struct {
 	// Next contains the time until the next study is available;
 	// it's only set if Total is 0.
 	Next time.Duration
+	// Reverse is true if the user needs to guess the explanation of a phrase.
+	// Phrase and Explanation are swapped in this case.
+	Reverse bool
+	// Cloze is true if the user needs to fill a gap in a text.
+	// Explanation is the text with the gap and Phrase is the missing part in this case.
+	Cloze bool
 }
 
+// AlternativesSeparator separates a phrase and its alternatives
+// in chat messages, imports and exports.
+const AlternativesSeparator = "|"
+
 // Phrase describes a phrase the user saved.
 type Phrase struct {
-	Phrase      string
-	Explanation string
-	Score       int
+	// Phrase is the text with cloze deletions for cloze phrases.
+	Phrase string
+	// Alternatives are other accepted versions of the phrase like synonyms.
+	Alternatives []string `json:",omitempty"`
+	Explanation  string
+	// Deck is the ID of the deck the phrase belongs to.
+	Deck int64 `json:",omitempty"`
+	// Direction is the direction the phrase is studied in.
+	Direction Direction `json:",omitempty"`
+	// Cloze is true if Phrase contains cloze deletions like {{c1::word}}.
+	Cloze bool `json:",omitempty"`
+	// ReviewState is the state of the forward study.
+	ReviewState
+	// Reverse is the state of the reverse study.
+	// It's nil if the phrase hasn't been studied in reverse yet.
+	Reverse *ReviewState `json:",omitempty"`
+	// Clozes are the states of the cloze studies by cloze index.
+	Clozes map[int]*ReviewState `json:",omitempty"`
+	// Lapses is the number of studies graded as not known.
+	Lapses int `json:",omitempty"`
+	// Suspended is true if the phrase is not studied anymore
+	// because it has been forgotten too often.
+	Suspended bool `json:",omitempty"`
+	// Tags are labels of imported phrases.
+	Tags []string `json:",omitempty"`
 }
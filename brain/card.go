@@ -0,0 +1,144 @@
+package brain
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Each phrase can have multiple cards which are studied separately.
+// A card has its own key in bucketStudytimes.
+// The key of a forward card is the phrase key.
+// All other cards use the phrase key followed by a suffix.
+
+// Length of a phrase key: chat ID and phrase ID
+const phraseKeyLen = 16
+
+const (
+	// Suffix of the keys of reverse cards
+	reverseSuffix = 'r'
+	// Suffix of the keys of cloze cards; followed by a byte for the cloze index
+	clozeSuffix = 'c'
+)
+
+func reverseKey(phraseKey []byte) []byte {
+	k := make([]byte, phraseKeyLen, phraseKeyLen+1)
+	copy(k, phraseKey)
+	return append(k, reverseSuffix)
+}
+
+func clozeKey(phraseKey []byte, index int) []byte {
+	k := make([]byte, phraseKeyLen, phraseKeyLen+2)
+	copy(k, phraseKey)
+	return append(k, clozeSuffix, byte(index))
+}
+
+// Get the phrase key of a studytimes key.
+func phraseKey(studyKey []byte) []byte {
+	return studyKey[:phraseKeyLen]
+}
+
+func isReverse(studyKey []byte) bool {
+	return len(studyKey) > phraseKeyLen && studyKey[phraseKeyLen] == reverseSuffix
+}
+
+// Get the cloze index of a studytimes key.
+// Returns 0 if the key doesn't belong to a cloze card.
+func clozeIndex(studyKey []byte) int {
+	if len(studyKey) != phraseKeyLen+2 || studyKey[phraseKeyLen] != clozeSuffix {
+		return 0
+	}
+	return int(studyKey[phraseKeyLen+1])
+}
+
+// Create the study times for all cards a phrase needs
+// and remove the ones not needed anymore.
+// New cards are due at the next time; existing study times are kept.
+func putCards(tx *bolt.Tx, key []byte, p Phrase, next time.Time) error {
+	needed := p.cardKeys(key)
+	bs := tx.Bucket(bucketStudytimes)
+	for _, k := range studytimesKeys(tx, key) {
+		isNeeded := false
+		for _, n := range needed {
+			isNeeded = isNeeded || bytes.Equal(k, n)
+		}
+		if !isNeeded {
+			if err := deleteStudytime(tx, k); err != nil {
+				return err
+			}
+		}
+	}
+	for _, k := range needed {
+		if bs.Get(k) != nil {
+			continue
+		}
+		if err := putStudytime(tx, k, next.Unix()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get the studytimes keys of all cards a phrase needs.
+func (p Phrase) cardKeys(key []byte) [][]byte {
+	var keys [][]byte
+	if p.Cloze {
+		for _, i := range clozeIndices(p.Phrase) {
+			keys = append(keys, clozeKey(key, i))
+		}
+		return keys
+	}
+	if p.Direction != DirectionReverse {
+		keys = append(keys, key)
+	}
+	if p.Direction != DirectionForward {
+		keys = append(keys, reverseKey(key))
+	}
+	return keys
+}
+
+// Remove study times of all cards of a phrase
+// and the phrase from the queue of new phrases.
+func deleteStudytimes(tx *bolt.Tx, key []byte) error {
+	for _, k := range studytimesKeys(tx, key) {
+		if err := deleteStudytime(tx, k); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(bucketNewQueue).Delete(key)
+}
+
+// Get the studytimes keys of all cards of a phrase.
+func studytimesKeys(tx *bolt.Tx, key []byte) [][]byte {
+	var keys [][]byte
+	c := tx.Bucket(bucketStudytimes).Cursor()
+	for k, _ := c.Seek(key); k != nil && bytes.HasPrefix(k, key); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	return keys
+}
+
+// Get the review state of the card with the given studytimes key.
+// Returns nil for reverse and cloze cards that have never been studied.
+func (p Phrase) cardState(studyKey []byte) *ReviewState {
+	if isReverse(studyKey) {
+		return p.Reverse
+	}
+	if i := clozeIndex(studyKey); i > 0 {
+		return p.Clozes[i]
+	}
+	return &p.ReviewState
+}
+
+// Get the review states of all cards of a phrase.
+func (p Phrase) cardStates() []ReviewState {
+	states := []ReviewState{p.ReviewState}
+	if p.Reverse != nil {
+		states = append(states, *p.Reverse)
+	}
+	for _, s := range p.Clozes {
+		states = append(states, *s)
+	}
+	return states
+}
@@ -0,0 +1,59 @@
+package brain
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoCloze is returned when a cloze phrase contains no cloze deletions.
+var ErrNoCloze = errors.New("no cloze deletions found")
+
+// Matches cloze deletions like {{c1::word}} or {{c1::word::hint}}.
+var clozePattern = regexp.MustCompile(`\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+
+// Cloze indices are stored in a single byte
+const maxClozeIndex = 255
+
+// IsCloze reports whether a text contains cloze deletions like {{c1::word}}.
+func IsCloze(text string) bool {
+	return len(clozeIndices(text)) > 0
+}
+
+// Get the distinct cloze indices of a text in ascending order.
+func clozeIndices(text string) []int {
+	seen := map[int]bool{}
+	var indices []int
+	for _, m := range clozePattern.FindAllStringSubmatch(text, -1) {
+		i, err := strconv.Atoi(m[1])
+		if err != nil || i < 1 || i > maxClozeIndex || seen[i] {
+			continue
+		}
+		seen[i] = true
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// Render the text for studying the cloze deletions with the given index.
+// Returns the question with these deletions blanked out
+// and the answer made of the hidden words.
+// All other deletions are displayed as normal text.
+func renderCloze(text string, index int) (string, string) {
+	var answers []string
+	question := clozePattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := clozePattern.FindStringSubmatch(s)
+		if i, err := strconv.Atoi(m[1]); err != nil || i != index {
+			return m[2]
+		}
+		answers = append(answers, m[2])
+		if m[3] != "" {
+			return "[" + m[3] + "]"
+		}
+		return "[...]"
+	})
+	return question, strings.Join(answers, " ")
+}
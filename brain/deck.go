@@ -0,0 +1,308 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// DefaultDeck is the ID of the deck every chat has.
+// It cannot be deleted.
+// Phrases added before decks existed have no deck set
+// and therefore belong to the default deck without any migration.
+const DefaultDeck int64 = 0
+
+const defaultDeckName = "Default"
+
+var (
+	// ErrDeckExists is returned when a chat already has a deck with the same name.
+	ErrDeckExists = errors.New("deck already exists")
+	// ErrDeckNotFound is returned when a chat has no deck with the given ID.
+	ErrDeckNotFound = errors.New("deck not found")
+	// ErrDeleteDefaultDeck is returned when trying to delete the default deck.
+	ErrDeleteDefaultDeck = errors.New("default deck cannot be deleted")
+)
+
+// The default deck as long as it has not been changed.
+func (s UserSettings) defaultDeck() Deck {
+	return Deck{ID: DefaultDeck, Name: defaultDeckName, Direction: s.Direction}
+}
+
+// Deck is a named collection of phrases.
+type Deck struct {
+	ID   int64
+	Name string
+	// Direction is the direction new phrases of the deck are studied in.
+	Direction Direction `json:",omitempty"`
+}
+
+// DeckSettings describe how a chat uses its decks.
+type DeckSettings struct {
+	// Current is the deck new phrases are added to.
+	Current int64
+	// StudyAll is true if phrases of all decks are studied.
+	// Otherwise only phrases of the current deck are studied.
+	StudyAll bool
+}
+
+// GetDecks returns all decks of a chat ordered by creation.
+// The first deck is always the default deck.
+func (store Bolt) GetDecks(chatID int64) ([]Deck, error) {
+	var decks []Deck
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		decks, err = getDecks(tx, chatID)
+		return err
+	})
+	if err != nil {
+		return decks, fmt.Errorf("failed to get decks for chatID %d: %v", chatID, err)
+	}
+	return decks, nil
+}
+
+func getDecks(tx *bolt.Tx, chatID int64) ([]Deck, error) {
+	settings, err := getUserSettings(tx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	decks := []Deck{settings.defaultDeck()}
+	c := tx.Bucket(bucketDecks).Cursor()
+	prefix := itob(chatID)
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var d Deck
+		if err := json.Unmarshal(v, &d); err != nil {
+			return decks, err
+		}
+		// The default deck is only stored after being renamed
+		if d.ID == DefaultDeck {
+			decks[0] = d
+			continue
+		}
+		decks = append(decks, d)
+	}
+	return decks, nil
+}
+
+// GetDeck returns the deck with the given ID.
+// Returns ErrDeckNotFound if the chat has no deck with the given ID.
+func (store Bolt) GetDeck(chatID, deckID int64) (Deck, error) {
+	var deck Deck
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		deck, err = getDeck(tx, chatID, deckID)
+		return err
+	})
+	if err == ErrDeckNotFound {
+		return deck, err
+	}
+	if err != nil {
+		return deck, fmt.Errorf("failed to get deck %d for chatID %d: %v", deckID, chatID, err)
+	}
+	return deck, nil
+}
+
+func getDeck(tx *bolt.Tx, chatID, deckID int64) (Deck, error) {
+	v := tx.Bucket(bucketDecks).Get(append(itob(chatID), itob(deckID)...))
+	if v == nil {
+		if deckID == DefaultDeck {
+			settings, err := getUserSettings(tx, chatID)
+			return settings.defaultDeck(), err
+		}
+		return Deck{}, ErrDeckNotFound
+	}
+	var d Deck
+	err := json.Unmarshal(v, &d)
+	return d, err
+}
+
+// AddDeck creates a new deck and returns its ID.
+// Phrases of the deck are studied in the direction set in the user settings.
+// Returns ErrDeckExists if the chat already has a deck with the same name.
+func (store Bolt) AddDeck(chatID int64, name string) (int64, error) {
+	var id int64
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		decks, err := getDecks(tx, chatID)
+		if err != nil {
+			return err
+		}
+		for _, d := range decks {
+			if d.Name == name {
+				return ErrDeckExists
+			}
+		}
+		bd := tx.Bucket(bucketDecks)
+		sequence, err := bd.NextSequence()
+		if err != nil {
+			return err
+		}
+		id = int64(sequence)
+		settings, err := getUserSettings(tx, chatID)
+		if err != nil {
+			return err
+		}
+		return putDeck(tx, chatID, Deck{ID: id, Name: name, Direction: settings.Direction})
+	})
+	if err == ErrDeckExists {
+		return id, err
+	}
+	if err != nil {
+		return id, fmt.Errorf("failed to add deck for chatID %d: %s: %v", chatID, name, err)
+	}
+	return id, nil
+}
+
+// RenameDeck sets a new name for a deck.
+// Returns ErrDeckExists if the chat already has a deck with the same name.
+func (store Bolt) RenameDeck(chatID, deckID int64, name string) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		decks, err := getDecks(tx, chatID)
+		if err != nil {
+			return err
+		}
+		for _, d := range decks {
+			if d.Name == name && d.ID != deckID {
+				return ErrDeckExists
+			}
+		}
+		deck, err := getDeck(tx, chatID, deckID)
+		if err != nil {
+			return err
+		}
+		deck.Name = name
+		return putDeck(tx, chatID, deck)
+	})
+	if err == ErrDeckExists || err == ErrDeckNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rename deck %d for chatID %d: %s: %v", deckID, chatID, name, err)
+	}
+	return nil
+}
+
+func putDeck(tx *bolt.Tx, chatID int64, d Deck) error {
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketDecks).Put(append(itob(chatID), itob(d.ID)...), buf)
+}
+
+// DeleteDeck removes a deck together with all its phrases.
+// If the deck is the current deck, the default deck becomes the current one.
+func (store Bolt) DeleteDeck(chatID, deckID int64) error {
+	if deckID == DefaultDeck {
+		return ErrDeleteDefaultDeck
+	}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		prefix := itob(chatID)
+		if err := tx.Bucket(bucketDecks).Delete(append(prefix, itob(deckID)...)); err != nil {
+			return err
+		}
+
+		// Collect keys first since deleting while iterating skips keys
+		bp := tx.Bucket(bucketPhrases)
+		var keys [][]byte
+		c := bp.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var p Phrase
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			if p.Deck == deckID {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range keys {
+			if err := deleteStudytimes(tx, k); err != nil {
+				return err
+			}
+			if err := bp.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		settings, err := getDeckSettings(tx, chatID)
+		if err != nil {
+			return err
+		}
+		if settings.Current != deckID {
+			return nil
+		}
+		settings.Current = DefaultDeck
+		return putDeckSettings(tx, chatID, settings)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete deck %d for chatID %d: %v", deckID, chatID, err)
+	}
+	return nil
+}
+
+// GetDeckSettings returns the deck settings of a chat.
+// By default phrases are added to the default deck and all decks are studied.
+func (store Bolt) GetDeckSettings(chatID int64) (DeckSettings, error) {
+	var settings DeckSettings
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		settings, err = getDeckSettings(tx, chatID)
+		return err
+	})
+	if err != nil {
+		return settings, fmt.Errorf("failed to get deck settings for chatID %d: %v", chatID, err)
+	}
+	return settings, nil
+}
+
+func getDeckSettings(tx *bolt.Tx, chatID int64) (DeckSettings, error) {
+	settings := DeckSettings{Current: DefaultDeck, StudyAll: true}
+	v := tx.Bucket(bucketDeckSettings).Get(itob(chatID))
+	if v == nil {
+		return settings, nil
+	}
+	err := json.Unmarshal(v, &settings)
+	return settings, err
+}
+
+// SetDeckSettings updates the deck settings of a chat.
+func (store Bolt) SetDeckSettings(chatID int64, settings DeckSettings) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return putDeckSettings(tx, chatID, settings)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set deck settings for chatID %d: %v", chatID, err)
+	}
+	return nil
+}
+
+func putDeckSettings(tx *bolt.Tx, chatID int64, settings DeckSettings) error {
+	buf, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketDeckSettings).Put(itob(chatID), buf)
+}
+
+// Returns a function to check if the phrase of a studytimes key
+// belongs to the decks a chat is studying and is not suspended.
+func studyFilter(tx *bolt.Tx, chatID int64) (func(key []byte) (bool, error), error) {
+	settings, err := getDeckSettings(tx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	bp := tx.Bucket(bucketPhrases)
+	return func(key []byte) (bool, error) {
+		var p Phrase
+		if err := json.Unmarshal(bp.Get(phraseKey(key)), &p); err != nil {
+			return false, err
+		}
+		return settings.studies(p), nil
+	}, nil
+}
+
+// Check if a phrase belongs to the decks studied with the settings and is not suspended.
+func (s DeckSettings) studies(p Phrase) bool {
+	return !p.Suspended && (s.StudyAll || p.Deck == s.Current)
+}
@@ -0,0 +1,99 @@
+package brain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Direction describes in which direction a phrase is studied.
+type Direction int
+
+const (
+	// DirectionForward shows the explanation and asks for the phrase.
+	DirectionForward Direction = iota
+	// DirectionReverse shows the phrase and asks for the explanation.
+	DirectionReverse
+	// DirectionBoth studies the phrase in both directions.
+	// Each direction has its own schedule.
+	DirectionBoth
+)
+
+var (
+	// ErrPhraseNotFound is returned when a chat has no phrase with the given ID.
+	ErrPhraseNotFound = errors.New("phrase not found")
+	// ErrClozeDirection is returned when setting the direction of a cloze phrase.
+	ErrClozeDirection = errors.New("cloze phrases have no direction")
+)
+
+// SetPhraseDirection changes the direction a phrase is studied in.
+// Studies of a newly added direction are scheduled like a new phrase.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store Bolt) SetPhraseDirection(chatID, phraseID int64, d Direction) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bp := tx.Bucket(bucketPhrases)
+		key := append(itob(chatID), itob(phraseID)...)
+		v := bp.Get(key)
+		if v == nil {
+			return ErrPhraseNotFound
+		}
+		var p Phrase
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		if err := p.setDirection(d); err != nil {
+			return err
+		}
+		buf, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := bp.Put(key, buf); err != nil {
+			return err
+		}
+		if err := dropUndo(tx, key); err != nil {
+			return err
+		}
+		return putCards(tx, key, p, time.Now().Add(firstStudytime*time.Hour))
+	})
+	if err == ErrPhraseNotFound || err == ErrClozeDirection {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set direction of phrase %d for chatID %d: %v", phraseID, chatID, err)
+	}
+	return nil
+}
+
+// Change the direction a phrase is studied in.
+// Returns ErrClozeDirection for cloze phrases.
+func (p *Phrase) setDirection(d Direction) error {
+	if p.Cloze {
+		return ErrClozeDirection
+	}
+	p.Direction = d
+	return nil
+}
+
+// SetDeckDirection sets the direction new phrases of a deck are studied in.
+// Returns ErrDeckNotFound if the chat has no deck with the given ID.
+func (store Bolt) SetDeckDirection(chatID, deckID int64, d Direction) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		deck, err := getDeck(tx, chatID, deckID)
+		if err != nil {
+			return err
+		}
+		deck.Direction = d
+		return putDeck(tx, chatID, deck)
+	})
+	if err == ErrDeckNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set direction of deck %d for chatID %d: %v", deckID, chatID, err)
+	}
+	return nil
+}
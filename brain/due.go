@@ -0,0 +1,239 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+)
+
+// bucketDue is an index of bucketStudytimes ordered by study time.
+// For each card there is a key made of
+// the chat ID, the big-endian study time and the rest of the studytimes key.
+// This way a cursor finds the next studies of a chat
+// without reading the study times of all its cards.
+// The value is the deck ID of the phrase.
+// bucketDeckDue is the same index with the deck ID after the chat ID,
+// so the studies of a single deck are found without reading the others.
+// The indexes must be updated together with bucketStudytimes;
+// use putStudytime and deleteStudytime for all changes of study times.
+// Cards of suspended phrases are left out of the indexes,
+// so are cards of phrases in the queue of new phrases
+// until they are taken from the queue; see queue.go.
+// Phrases never change their deck;
+// when a phrase is suspended, its cards are removed with unindexPhrase,
+// and when it is unsuspended or restored by an undo, they are indexed again with indexPhrase.
+
+func dueKey(studyKey []byte, t int64) []byte {
+	// Times before 1970 don't occur; keep them in order anyway
+	if t < 0 {
+		t = 0
+	}
+	k := make([]byte, 16, len(studyKey)+8)
+	copy(k, studyKey[:8])
+	binary.BigEndian.PutUint64(k[8:], uint64(t))
+	return append(k, studyKey[8:]...)
+}
+
+func deckDueKey(studyKey []byte, deck, t int64) []byte {
+	k := dueKey(studyKey, t)
+	return append(append(append(make([]byte, 0, len(k)+8), k[:8]...), itob(deck)...), k[8:]...)
+}
+
+// Get the studytimes key and the study time of a key of the due index.
+func parseDueKey(k []byte) ([]byte, int64) {
+	key := make([]byte, 0, len(k)-8)
+	key = append(key, k[:8]...)
+	key = append(key, k[16:]...)
+	return key, int64(binary.BigEndian.Uint64(k[8:16]))
+}
+
+// Set the study time of a card.
+func putStudytime(tx *bolt.Tx, key []byte, t int64) error {
+	if err := deleteDue(tx, key); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketStudytimes).Put(key, itob(t)); err != nil {
+		return err
+	}
+	return putDue(tx, key, t)
+}
+
+// Remove the study time of a card.
+func deleteStudytime(tx *bolt.Tx, key []byte) error {
+	if err := deleteDue(tx, key); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketStudytimes).Delete(key)
+}
+
+// Remove a card from the due index.
+func deleteDue(tx *bolt.Tx, key []byte) error {
+	v := tx.Bucket(bucketStudytimes).Get(key)
+	if v == nil {
+		return nil
+	}
+	t, err := btoi(v)
+	if err != nil {
+		return err
+	}
+	bd := tx.Bucket(bucketDue)
+	k := dueKey(key, t)
+	// Entries of old schema versions have no deck
+	if v := bd.Get(k); len(v) > 0 {
+		deck, err := btoi(v)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketDeckDue).Delete(deckDueKey(key, deck, t)); err != nil {
+			return err
+		}
+	}
+	return bd.Delete(k)
+}
+
+// Add a card with the given study time to the due indexes
+// unless its phrase is suspended or queued.
+func putDue(tx *bolt.Tx, key []byte, t int64) error {
+	if isQueued(tx, key) {
+		return nil
+	}
+	var p Phrase
+	if err := json.Unmarshal(tx.Bucket(bucketPhrases).Get(phraseKey(key)), &p); err != nil {
+		return err
+	}
+	if p.Suspended {
+		return nil
+	}
+	if err := tx.Bucket(bucketDue).Put(dueKey(key, t), itob(p.Deck)); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketDeckDue).Put(deckDueKey(key, p.Deck, t), []byte{})
+}
+
+// Index the cards of a phrase again after it has changed.
+func indexPhrase(tx *bolt.Tx, key []byte) error {
+	bs := tx.Bucket(bucketStudytimes)
+	for _, k := range studytimesKeys(tx, key) {
+		if err := deleteDue(tx, k); err != nil {
+			return err
+		}
+		t, err := btoi(bs.Get(k))
+		if err != nil {
+			return err
+		}
+		if err := putDue(tx, k, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the cards of a phrase from the due indexes.
+func unindexPhrase(tx *bolt.Tx, key []byte) error {
+	for _, k := range studytimesKeys(tx, key) {
+		if err := deleteDue(tx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build the due index from the study times of all cards.
+// Only used by migrations of old schema versions
+// which don't have the keys and buckets reindexStudytimes needs.
+func indexStudytimes(tx *bolt.Tx) error {
+	bd := tx.Bucket(bucketDue)
+	return tx.Bucket(bucketStudytimes).ForEach(func(k, v []byte) error {
+		t, err := btoi(v)
+		if err != nil {
+			return err
+		}
+		return bd.Put(dueKey(k, t), []byte{})
+	})
+}
+
+// Build the due indexes from scratch.
+func reindexStudytimes(tx *bolt.Tx) error {
+	for _, bucket := range [][]byte{bucketDue, bucketDeckDue} {
+		if err := tx.DeleteBucket(bucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(bucket); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(bucketStudytimes).ForEach(func(k, v []byte) error {
+		t, err := btoi(v)
+		if err != nil {
+			return err
+		}
+		return putDue(tx, k, t)
+	})
+}
+
+// Card and its study time
+type dueCard struct {
+	key  []byte
+	time int64
+}
+
+// Cursor over the studies of a chat ordered by study time
+// as used by the scheduling shared by all stores.
+// Only studies of the decks the chat is studying are included;
+// suspended phrases and phrases in the queue of new phrases are left out.
+// first and next return the studytimes key and the study time of a study.
+// The key is nil if there are no more studies.
+type studyCursor interface {
+	first() ([]byte, int64)
+	next() ([]byte, int64)
+}
+
+// Cursor over the due studies of a chat ordered by study time.
+// Only studies of the decks the chat is studying are included.
+type dueCursor struct {
+	c      *bolt.Cursor
+	prefix []byte
+	// deck is true for a cursor of bucketDeckDue
+	deck bool
+}
+
+func newDueCursor(tx *bolt.Tx, chatID int64) (dueCursor, error) {
+	settings, err := getDeckSettings(tx, chatID)
+	if err != nil {
+		return dueCursor{}, err
+	}
+	if settings.StudyAll {
+		return dueCursor{c: tx.Bucket(bucketDue).Cursor(), prefix: itob(chatID)}, nil
+	}
+	return dueCursor{
+		c:      tx.Bucket(bucketDeckDue).Cursor(),
+		prefix: append(itob(chatID), itob(settings.Current)...),
+		deck:   true,
+	}, nil
+}
+
+// Get the studytimes key and study time of the first study.
+// The key is nil if there are no studies.
+func (c dueCursor) first() ([]byte, int64) {
+	k, _ := c.c.Seek(c.prefix)
+	return c.parse(k)
+}
+
+// Get the studytimes key and study time of the next study.
+// The key is nil if there are no more studies.
+func (c dueCursor) next() ([]byte, int64) {
+	k, _ := c.c.Next()
+	return c.parse(k)
+}
+
+func (c dueCursor) parse(k []byte) ([]byte, int64) {
+	if k == nil || !bytes.HasPrefix(k, c.prefix) {
+		return nil, 0
+	}
+	if c.deck {
+		k = append(append([]byte(nil), k[:8]...), k[16:]...)
+	}
+	return parseDueKey(k)
+}
@@ -0,0 +1,207 @@
+package brain
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Open a Bolt store in a temporary directory.
+// The returned function closes the store and removes the directory.
+func openTestBolt(t testing.TB, options ...func(*Options)) (*Bolt, func()) {
+	dir, err := ioutil.TempDir("", "brain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := New(filepath.Join(dir, "test.db"), options...)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Get the studytimes keys of a chat in the due index.
+func dueKeys(t testing.TB, store *Bolt, chatID int64) [][]byte {
+	var keys [][]byte
+	err := store.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketDue).Cursor()
+		prefix := itob(chatID)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			key, _ := parseDueKey(k)
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestQueueNotIndexed(t *testing.T) {
+	store, cleanup := openTestBolt(t)
+	defer cleanup()
+	const chatID = 1
+	settings := DefaultSettings()
+	settings.NewPerDay = 1
+	if err := store.SetUserSettings(chatID, settings); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, p := range []string{"uno", "dos", "tres"} {
+		id, err := store.AddPhrase(chatID, p, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if keys := dueKeys(t, store, chatID); len(keys) != 0 {
+		t.Fatalf("expected queued phrases not to be indexed, got %d keys", len(keys))
+	}
+	// Rebuilding the index leaves them out as well
+	if err := store.StudyNow(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := dueKeys(t, store, chatID); len(keys) != 0 {
+		t.Fatalf("expected queued phrases not to be indexed again, got %d keys", len(keys))
+	}
+
+	// Studying takes the phrase from the queue and indexes it
+	study, err := store.GetStudy(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if study.Total != 1 || study.PhraseID != ids[0] {
+		t.Fatalf("expected study of phrase %d, got %+v", ids[0], study)
+	}
+	if _, err := store.ScoreStudy(chatID, 1, Answer{}); err != nil {
+		t.Fatal(err)
+	}
+	keys := dueKeys(t, store, chatID)
+	if len(keys) != 1 || !bytes.Equal(phraseKey(keys[0]), memoryKey(chatID, ids[0])) {
+		t.Fatalf("expected only phrase %d to be indexed, got %q", ids[0], keys)
+	}
+	study, err = store.GetStudy(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if study.Total != 0 || study.Next <= 0 {
+		t.Errorf("expected no more new phrases today, got %+v", study)
+	}
+
+	// Undoing puts the phrase back to the queue
+	if _, err := store.UndoStudy(chatID); err != nil {
+		t.Fatal(err)
+	}
+	if keys := dueKeys(t, store, chatID); len(keys) != 0 {
+		t.Errorf("expected the phrase to be removed from the index again, got %q", keys)
+	}
+}
+
+func TestSuspendedNotIndexed(t *testing.T) {
+	store, cleanup := openTestBolt(t)
+	defer cleanup()
+	const chatID = 1
+	deckID, err := store.AddDeck(chatID, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetDeckSettings(chatID, DeckSettings{Current: deckID}); err != nil {
+		t.Fatal(err)
+	}
+	state := ReviewState{Score: 1, Reviewed: time.Now().AddDate(0, 0, -2), Interval: 24 * time.Hour}
+	ids, err := store.ImportPhrases(chatID, []Phrase{
+		{Phrase: "uno", Explanation: "one", ReviewState: state, Suspended: true},
+		{Phrase: "dos", Explanation: "two", ReviewState: state},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := dueKeys(t, store, chatID)
+	if len(keys) != 1 || !bytes.Equal(phraseKey(keys[0]), memoryKey(chatID, ids[1])) {
+		t.Fatalf("expected only phrase %d to be indexed, got %q", ids[1], keys)
+	}
+
+	if err := store.UnsuspendPhrase(chatID, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if keys := dueKeys(t, store, chatID); len(keys) != 2 {
+		t.Fatalf("expected unsuspended phrase to be indexed, got %q", keys)
+	}
+	err = store.db.View(func(tx *bolt.Tx) error {
+		due, err := newDueCursor(tx, chatID)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for key, _ := due.first(); key != nil; key, _ = due.next() {
+			n++
+		}
+		if !due.deck || n != 2 {
+			t.Errorf("expected 2 studies in the index of deck %d, got %d", deckID, n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Studies of other decks are not found
+	if err := store.SetDeckSettings(chatID, DeckSettings{Current: DefaultDeck}); err != nil {
+		t.Fatal(err)
+	}
+	study, err := store.GetStudy(chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if study.Total != 0 || study.Next != 0 {
+		t.Errorf("expected no studies in the default deck, got %+v", study)
+	}
+}
+
+func TestLeechNotIndexed(t *testing.T) {
+	store, cleanup := openTestBolt(t, LeechThreshold(1))
+	defer cleanup()
+	const chatID = 1
+	if err := store.SetDeckDirection(chatID, DefaultDeck, DirectionBoth); err != nil {
+		t.Fatal(err)
+	}
+	state := ReviewState{Score: 1, Reviewed: time.Now().AddDate(0, 0, -2), Interval: 24 * time.Hour}
+	reverse := state
+	_, err := store.ImportPhrases(chatID, []Phrase{
+		{Phrase: "uno", Explanation: "one", ReviewState: state, Reverse: &reverse},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := dueKeys(t, store, chatID); len(keys) != 2 {
+		t.Fatalf("expected both cards to be indexed, got %q", keys)
+	}
+	suspended, err := store.ScoreStudy(chatID, -1, Answer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !suspended {
+		t.Fatal("expected phrase to be suspended")
+	}
+	if keys := dueKeys(t, store, chatID); len(keys) != 0 {
+		t.Errorf("expected no card of the suspended phrase to be indexed, got %q", keys)
+	}
+
+	// Undoing the lapse indexes both cards again
+	if _, err := store.UndoStudy(chatID); err != nil {
+		t.Fatal(err)
+	}
+	if keys := dueKeys(t, store, chatID); len(keys) != 2 {
+		t.Errorf("expected both cards to be indexed again, got %q", keys)
+	}
+}
@@ -0,0 +1,228 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Format is a file format phrases can be exported to.
+type Format string
+
+const (
+	// FormatCSV is a CSV file with a header.
+	// Alternatives and tags are written like they are read by the CSV import.
+	FormatCSV Format = "csv"
+	// FormatAnki is a tab-separated text file Anki can import.
+	// Anki's text import cannot set study times,
+	// so only the notes are exported.
+	FormatAnki Format = "anki"
+	// FormatJSONL is a JSON object per line with all stored data of a phrase.
+	FormatJSONL Format = "jsonl"
+)
+
+// Formats are all supported export formats.
+var Formats = []Format{FormatCSV, FormatAnki, FormatJSONL}
+
+// ErrUnknownFormat is returned when exporting to a format that is not supported.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Extension returns the file extension for the format.
+func (f Format) Extension() string {
+	if f == FormatAnki {
+		return "txt"
+	}
+	return string(f)
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	}
+	return "text/plain"
+}
+
+// A phrase with its schedule and review history as it is exported.
+type exportedPhrase struct {
+	ID int64
+	Phrase
+	DeckName string
+	// Due is the earliest study time of the cards of the phrase.
+	// It's the zero time if the phrase has no study times.
+	Due     time.Time
+	Reviews []Review
+}
+
+// Export writes all phrases of a chat in the given format.
+// Returns ErrUnknownFormat if the format is not supported.
+func (store Bolt) Export(chatID int64, format Format, w io.Writer) error {
+	var phrases []exportedPhrase
+	err := store.db.View(func(tx *bolt.Tx) error {
+		decks, err := getDecks(tx, chatID)
+		if err != nil {
+			return err
+		}
+		reviews := map[int64][]Review{}
+		prefix := itob(chatID)
+		c := tx.Bucket(bucketReviews).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var r Review
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			reviews[r.PhraseID] = append(reviews[r.PhraseID], r)
+		}
+		bs := tx.Bucket(bucketStudytimes)
+		c = tx.Bucket(bucketPhrases).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			id, err := btoi(k[8:])
+			if err != nil {
+				return err
+			}
+			var p Phrase
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			var studytimes []int64
+			for _, key := range studytimesKeys(tx, k) {
+				t, err := btoi(bs.Get(key))
+				if err != nil {
+					return err
+				}
+				studytimes = append(studytimes, t)
+			}
+			phrases = append(phrases, newExportedPhrase(id, p, decks, studytimes, reviews[id]))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export phrases for chatID %d: %v", chatID, err)
+	}
+	return writeExport(w, format, phrases)
+}
+
+func newExportedPhrase(id int64, p Phrase, decks []Deck, studytimes []int64, reviews []Review) exportedPhrase {
+	e := exportedPhrase{ID: id, Phrase: p, Reviews: reviews}
+	for _, d := range decks {
+		if d.ID == p.Deck {
+			e.DeckName = d.Name
+		}
+	}
+	for i, t := range studytimes {
+		if i == 0 || t < e.Due.Unix() {
+			e.Due = time.Unix(t, 0)
+		}
+	}
+	return e
+}
+
+func writeExport(w io.Writer, format Format, phrases []exportedPhrase) error {
+	var err error
+	switch format {
+	case FormatCSV:
+		err = writeCSV(w, phrases)
+	case FormatAnki:
+		err = writeAnki(w, phrases)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, p := range phrases {
+			if err = enc.Encode(p); err != nil {
+				break
+			}
+		}
+	default:
+		return ErrUnknownFormat
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s export: %v", format, err)
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, phrases []exportedPhrase) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{
+		"id", "deck", "phrase", "alternatives", "explanation", "tags",
+		"score", "due", "suspended", "reviews",
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range phrases {
+		// Reviews like "2006-01-02T15:04:05Z 1; 2006-01-03T15:04:05Z -1"
+		var reviews []string
+		for _, r := range p.Reviews {
+			reviews = append(reviews, r.Time.UTC().Format(time.RFC3339)+" "+strconv.Itoa(r.Grade))
+		}
+		due := ""
+		if !p.Due.IsZero() {
+			due = p.Due.UTC().Format(time.RFC3339)
+		}
+		err := cw.Write([]string{
+			strconv.FormatInt(p.ID, 10),
+			p.DeckName,
+			p.Phrase.Phrase,
+			strings.Join(p.Alternatives, AlternativesSeparator),
+			p.Explanation,
+			strings.Join(p.Tags, " "),
+			strconv.Itoa(p.Score),
+			due,
+			strconv.FormatBool(p.Suspended),
+			strings.Join(reviews, "; "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Anki reads the headers starting with # to set up the import.
+// The note type is set per line since cloze phrases need a note type of their own.
+// Basic notes have the fields front and back, cloze notes have text and extra.
+const ankiHeader = `#separator:tab
+#html:true
+#notetype column:1
+#deck column:2
+#tags column:5
+`
+
+func writeAnki(w io.Writer, phrases []exportedPhrase) error {
+	if _, err := io.WriteString(w, ankiHeader); err != nil {
+		return err
+	}
+	for _, p := range phrases {
+		fields := []string{"Basic", p.DeckName, p.Explanation, p.Phrase.Phrase, strings.Join(p.Tags, " ")}
+		if p.Cloze {
+			fields = []string{"Cloze", p.DeckName, p.Phrase.Phrase, p.Explanation, strings.Join(p.Tags, " ")}
+		}
+		for i, f := range fields {
+			fields[i] = ankiField(f)
+		}
+		if _, err := io.WriteString(w, strings.Join(fields, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Escape a field for an HTML file with tab-separated fields.
+func ankiField(s string) string {
+	s = html.EscapeString(s)
+	s = strings.Replace(s, "\t", " ", -1)
+	return strings.Replace(s, "\n", "<br>", -1)
+}
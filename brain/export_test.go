@@ -0,0 +1,95 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// ScanStudy gets the current study like GetStudy does
+// but reads the study times of all cards of the chat
+// and decodes the phrase of each one to filter it,
+// like it has been done before the due index existed.
+// It is the baseline of the benchmarks of the due index.
+// Phrases in the queue of new phrases and learning steps are not considered.
+func (store Bolt) ScanStudy(chatID int64) (Study, error) {
+	var study Study
+	err := store.db.View(func(tx *bolt.Tx) error {
+		inDeck, err := studyFilter(tx, chatID)
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		total := 0
+		var keyTime int64
+		var key []byte
+		c := tx.Bucket(bucketStudytimes).Cursor()
+		prefix := itob(chatID)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if ok, err := inDeck(k); err != nil || !ok {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			timestamp, err := btoi(v)
+			if err != nil {
+				return err
+			}
+			if key == nil || timestamp < keyTime {
+				keyTime = timestamp
+				key = append([]byte(nil), k...)
+			}
+			if timestamp <= now {
+				total++
+			}
+		}
+		if total == 0 {
+			if key != nil {
+				study = Study{Next: time.Second * time.Duration(keyTime-now)}
+			}
+			return nil
+		}
+		var p Phrase
+		if err := json.Unmarshal(tx.Bucket(bucketPhrases).Get(phraseKey(key)), &p); err != nil {
+			return err
+		}
+		study, err = newStudy(key, p, total)
+		return err
+	})
+	return study, err
+}
+
+func TestWriteCSV(t *testing.T) {
+	due := time.Date(2017, 6, 15, 12, 0, 0, 0, time.UTC)
+	phrases := []exportedPhrase{
+		{ID: 1, Phrase: Phrase{Phrase: "hola", Alternatives: []string{"buenas", "buenos d\u00edas"}, Explanation: "hello"}, Due: due},
+		{ID: 2, Phrase: Phrase{Phrase: "adios", Explanation: "bye"}},
+	}
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, phrases); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %q", records)
+	}
+	// Alternatives are split again like the CSV import does
+	if alternatives := strings.Split(records[1][3], AlternativesSeparator); len(alternatives) != 2 || alternatives[1] != "buenos d\u00edas" {
+		t.Errorf("expected alternatives separated by %s, got %q", AlternativesSeparator, records[1][3])
+	}
+	if records[1][7] != "2017-06-15T12:00:00Z" {
+		t.Errorf("expected due time, got %q", records[1][7])
+	}
+	if records[2][7] != "" {
+		t.Errorf("expected empty due time for phrase without study times, got %q", records[2][7])
+	}
+}
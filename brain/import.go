@@ -0,0 +1,100 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// ImportPhrases adds many phrases to the current deck of the chat at once.
+// The deck and direction of the passed phrases are ignored.
+// Cards with a review state that has an interval are due
+// when the interval since their latest study is over,
+// all other cards are scheduled like for phrases added one by one.
+// Like phrases added one by one, a phrase is skipped
+// if the chat already has a phrase with the same explanation.
+// All phrases are added in a single transaction;
+// if one of them fails, none is added.
+// Returns the ID of each added phrase or 0 if the phrase has been skipped.
+func (store Bolt) ImportPhrases(chatID int64, phrases []Phrase) ([]int64, error) {
+	ids := make([]int64, len(phrases))
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		var existing []string
+		c := tx.Bucket(bucketPhrases).Cursor()
+		prefix := itob(chatID)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var p Phrase
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			existing = append(existing, p.Explanation)
+		}
+		isDuplicate := duplicateCheck(existing)
+		for i, p := range phrases {
+			if isDuplicate(p) {
+				continue
+			}
+			id, err := addPhrase(tx, chatID, p.imported())
+			if err != nil {
+				return fmt.Errorf("%s - %s: %v", p.Phrase, p.Explanation, err)
+			}
+			for _, k := range studytimesKeys(tx, append(itob(chatID), itob(id)...)) {
+				if next, ok := p.importedStudytime(k); ok {
+					if err := putStudytime(tx, k, next); err != nil {
+						return err
+					}
+				}
+			}
+			ids[i] = id
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import phrases for chatID %d: %v", chatID, err)
+	}
+	return ids, nil
+}
+
+// Returns a function reporting if a phrase has the same explanation
+// as one of the existing explanations or as a phrase passed before.
+func duplicateCheck(existing []string) func(Phrase) bool {
+	seen := map[string]bool{}
+	for _, e := range existing {
+		seen[e] = true
+	}
+	return func(p Phrase) bool {
+		if seen[p.Explanation] {
+			return true
+		}
+		seen[p.Explanation] = true
+		return false
+	}
+}
+
+// Get the fields of a phrase that are kept when importing it.
+func (p Phrase) imported() Phrase {
+	return Phrase{
+		Phrase:       p.Phrase,
+		Alternatives: p.Alternatives,
+		Explanation:  p.Explanation,
+		Cloze:        p.Cloze,
+		ReviewState:  p.ReviewState,
+		Reverse:      p.Reverse,
+		Clozes:       p.Clozes,
+		Lapses:       p.Lapses,
+		Suspended:    p.Suspended,
+		Tags:         p.Tags,
+	}
+}
+
+// Get the study time of an imported card from its review state.
+// Returns false if the card has no interval yet.
+func (p Phrase) importedStudytime(studyKey []byte) (int64, bool) {
+	state := p.cardState(studyKey)
+	if state == nil || state.Interval <= 0 {
+		return 0, false
+	}
+	return state.Reviewed.Add(state.Interval).Unix(), true
+}
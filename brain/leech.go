@@ -0,0 +1,138 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Leech is a phrase that has been suspended
+// because it has been forgotten too often.
+type Leech struct {
+	PhraseID int64
+	Phrase   Phrase
+}
+
+// GetSuspended returns all suspended phrases of a chat ordered by creation.
+func (store Bolt) GetSuspended(chatID int64) ([]Leech, error) {
+	var leeches []Leech
+	err := store.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketPhrases).Cursor()
+		prefix := itob(chatID)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var p Phrase
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			if !p.Suspended {
+				continue
+			}
+			id, err := btoi(k[8:])
+			if err != nil {
+				return err
+			}
+			leeches = append(leeches, Leech{PhraseID: id, Phrase: p})
+		}
+		return nil
+	})
+	if err != nil {
+		return leeches, fmt.Errorf("failed to get suspended phrases for chatID %d: %v", chatID, err)
+	}
+	return leeches, nil
+}
+
+// UnsuspendPhrase continues studying a suspended phrase.
+// The study times are kept and the phrase can lapse as often as a new phrase
+// before being suspended again.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store Bolt) UnsuspendPhrase(chatID, phraseID int64) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		err := updatePhrase(tx, chatID, phraseID, func(p *Phrase) error {
+			p.unsuspend()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return indexPhrase(tx, append(itob(chatID), itob(phraseID)...))
+	})
+	if err == ErrPhraseNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unsuspend phrase %d for chatID %d: %v", phraseID, chatID, err)
+	}
+	return nil
+}
+
+// ResetPhrase forgets all progress of a phrase and makes all its studies ready now.
+// Suspended phrases are studied again.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store Bolt) ResetPhrase(chatID, phraseID int64) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		err := updatePhrase(tx, chatID, phraseID, func(p *Phrase) error {
+			p.reset()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		for _, k := range studytimesKeys(tx, append(itob(chatID), itob(phraseID)...)) {
+			if err := putStudytime(tx, k, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == ErrPhraseNotFound {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reset phrase %d for chatID %d: %v", phraseID, chatID, err)
+	}
+	return nil
+}
+
+// Study a suspended phrase again.
+// It can lapse as often as a new phrase before being suspended again.
+func (p *Phrase) unsuspend() {
+	p.Suspended = false
+	p.Lapses = 0
+}
+
+// Forget all progress of a phrase.
+func (p *Phrase) reset() {
+	p.ReviewState = ReviewState{}
+	p.Reverse = nil
+	p.Clozes = nil
+	p.unsuspend()
+}
+
+// Load a phrase, change it with fn and save it again.
+func updatePhrase(tx *bolt.Tx, chatID, phraseID int64, fn func(*Phrase) error) error {
+	bp := tx.Bucket(bucketPhrases)
+	key := append(itob(chatID), itob(phraseID)...)
+	v := bp.Get(key)
+	if v == nil {
+		return ErrPhraseNotFound
+	}
+	var p Phrase
+	if err := json.Unmarshal(v, &p); err != nil {
+		return err
+	}
+	if err := fn(&p); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := bp.Put(key, buf); err != nil {
+		return err
+	}
+	return dropUndo(tx, key)
+}
@@ -0,0 +1,1019 @@
+package brain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a Store keeping all data in memory.
+// All data is lost when the process exits.
+// It is meant for tests and for trying out the bot.
+// Memory only stores the data;
+// the scheduling is shared with Bolt, which provides the same studyCursor and queue.
+type Memory struct {
+	mu    sync.Mutex
+	opts  Options
+	chats map[int64]*memoryChat
+	// Sequences for IDs of phrases and decks of all chats
+	phraseSeq int64
+	deckSeq   int64
+}
+
+var _ Store = (*Memory)(nil)
+
+type memoryChat struct {
+	// mode is nil if it has never been set
+	mode *Mode
+	// modePhrase is 0 if the mode has been set without a phrase
+	modePhrase int64
+	phrases    map[int64]Phrase
+	// Study times by studytimes key as used by Bolt
+	studytimes   map[string]int64
+	reviews      []Review
+	decks        map[int64]Deck
+	deckSettings *DeckSettings
+	settings     *UserSettings
+	subscribed   bool
+	activity     int64
+	// read is nil if the user has never read a message
+	read *int64
+	undo *memoryUndo
+	// pausedSince is nil if the chat is not paused
+	pausedSince *int64
+	// IDs of the phrases in the queue of new phrases
+	queued   map[int64]bool
+	newCount newCount
+	// Day the backlog has been spread last
+	backlogDay string
+}
+
+// Snapshot of a card taken before it has been scored.
+type memoryUndo struct {
+	card      string
+	phrase    Phrase
+	studytime int64
+	queued    bool
+}
+
+// NewMemory returns a new empty Memory store.
+// The options UseScheduler, LeechThreshold and LearningSteps can be used.
+func NewMemory(options ...func(*Options)) *Memory {
+	return &Memory{opts: newOptions(options), chats: map[int64]*memoryChat{}}
+}
+
+// Get a chat and create it if needed.
+// The store must be locked.
+func (store *Memory) chat(chatID int64) *memoryChat {
+	c, ok := store.chats[chatID]
+	if !ok {
+		c = &memoryChat{
+			phrases:    map[int64]Phrase{},
+			studytimes: map[string]int64{},
+			decks:      map[int64]Deck{},
+			queued:     map[int64]bool{},
+		}
+		store.chats[chatID] = c
+	}
+	return c
+}
+
+// Copy a phrase so the stored phrase cannot be changed from outside.
+func (p Phrase) copy() Phrase {
+	if p.Alternatives != nil {
+		p.Alternatives = append([]string{}, p.Alternatives...)
+	}
+	if p.Tags != nil {
+		p.Tags = append([]string{}, p.Tags...)
+	}
+	if p.Reverse != nil {
+		r := *p.Reverse
+		p.Reverse = &r
+	}
+	if p.Clozes != nil {
+		clozes := map[int]*ReviewState{}
+		for i, s := range p.Clozes {
+			c := *s
+			clozes[i] = &c
+		}
+		p.Clozes = clozes
+	}
+	return p
+}
+
+func memoryKey(chatID, phraseID int64) []byte {
+	return append(itob(chatID), itob(phraseID)...)
+}
+
+// IDs of all phrases of the chat in order of creation.
+func (c *memoryChat) phraseIDs() []int64 {
+	var ids sortableInts
+	for id := range c.phrases {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+	return ids
+}
+
+// Studytimes keys of the chat in the same order Bolt uses.
+func (c *memoryChat) studytimesKeys(prefix []byte) []string {
+	var keys []string
+	for k := range c.studytimes {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *memoryChat) putCards(key []byte, p Phrase, next time.Time) {
+	needed := map[string]bool{}
+	for _, k := range p.cardKeys(key) {
+		needed[string(k)] = true
+	}
+	for _, k := range c.studytimesKeys(key) {
+		if !needed[k] {
+			delete(c.studytimes, k)
+		}
+	}
+	for k := range needed {
+		if _, ok := c.studytimes[k]; !ok {
+			c.studytimes[k] = next.Unix()
+		}
+	}
+}
+
+func (c *memoryChat) deletePhrase(chatID, phraseID int64) {
+	for _, k := range c.studytimesKeys(memoryKey(chatID, phraseID)) {
+		delete(c.studytimes, k)
+	}
+	delete(c.phrases, phraseID)
+	delete(c.queued, phraseID)
+	c.dropUndo(phraseID)
+}
+
+// See dropUndo.
+func (c *memoryChat) dropUndo(phraseID int64) {
+	if c.undo != nil && phraseIDOf(c.undo.card) == phraseID {
+		c.undo = nil
+	}
+}
+
+func (c *memoryChat) getDeckSettings() DeckSettings {
+	if c.deckSettings == nil {
+		return DeckSettings{Current: DefaultDeck, StudyAll: true}
+	}
+	return *c.deckSettings
+}
+
+func (c *memoryChat) getSettings() UserSettings {
+	if c.settings == nil {
+		return DefaultSettings()
+	}
+	return *c.settings
+}
+
+func (c *memoryChat) getDecks() []Deck {
+	decks := []Deck{c.getSettings().defaultDeck()}
+	for _, d := range c.decks {
+		// The default deck is only stored after being renamed
+		if d.ID == DefaultDeck {
+			decks[0] = d
+			continue
+		}
+		decks = append(decks, d)
+	}
+	sort.Slice(decks, func(i, j int) bool {
+		return decks[i].ID < decks[j].ID
+	})
+	return decks
+}
+
+func (c *memoryChat) getDeck(deckID int64) (Deck, error) {
+	d, ok := c.decks[deckID]
+	if !ok {
+		if deckID == DefaultDeck {
+			return c.getSettings().defaultDeck(), nil
+		}
+		return Deck{}, ErrDeckNotFound
+	}
+	return d, nil
+}
+
+// Get the phrase ID of a studytimes key.
+func phraseIDOf(key string) int64 {
+	id, _ := btoi([]byte(key[8:phraseKeyLen]))
+	return id
+}
+
+// Check if the card of a studytimes key is studied. See studyFilter.
+func (c *memoryChat) isStudied(key string) bool {
+	return c.getDeckSettings().studies(c.phrases[phraseIDOf(key)])
+}
+
+// See getNewCount.
+func (c *memoryChat) getNewCount(now time.Time) int {
+	return c.newCount.on(c.getSettings().day(now))
+}
+
+// See addNewCount.
+func (c *memoryChat) addNewCount(now time.Time, n int) {
+	c.newCount = c.newCount.add(c.getSettings().day(now), n)
+}
+
+// See frontOfQueue.
+func (c *memoryChat) frontOfQueue(chatID int64, now time.Time) ([]dueCard, *dueCard) {
+	var queued []int64
+	for _, id := range c.phraseIDs() {
+		if c.queued[id] && c.isStudied(string(memoryKey(chatID, id))) {
+			queued = append(queued, id)
+		}
+	}
+	next := func() ([]dueCard, bool, error) {
+		if len(queued) == 0 {
+			return nil, false, nil
+		}
+		var cards []dueCard
+		for _, k := range c.studytimesKeys(memoryKey(chatID, queued[0])) {
+			cards = append(cards, dueCard{key: []byte(k), time: c.studytimes[k]})
+		}
+		queued = queued[1:]
+		return cards, true, nil
+	}
+	// Reading the queue from memory doesn't fail
+	front, waiting, _ := queueFront(c.getSettings(), c.getNewCount(now), now, next)
+	return front, waiting
+}
+
+// Cursor over the studies of the chat. See dueCursor.
+func (c *memoryChat) dueCursor(chatID int64) *memoryCursor {
+	var cards []dueCard
+	for _, k := range c.studytimesKeys(itob(chatID)) {
+		if c.isStudied(k) && !c.queued[phraseIDOf(k)] {
+			cards = append(cards, dueCard{key: []byte(k), time: c.studytimes[k]})
+		}
+	}
+	// Keys are sorted already so cards due at the same time keep the order of the due index
+	sort.SliceStable(cards, func(i, j int) bool {
+		return cards[i].time < cards[j].time
+	})
+	return &memoryCursor{cards: cards}
+}
+
+// Cursor over cards ordered by study time.
+type memoryCursor struct {
+	cards []dueCard
+	i     int
+}
+
+func (c *memoryCursor) first() ([]byte, int64) {
+	c.i = 0
+	return c.card()
+}
+
+func (c *memoryCursor) next() ([]byte, int64) {
+	c.i++
+	return c.card()
+}
+
+func (c *memoryCursor) card() ([]byte, int64) {
+	if c.i >= len(c.cards) {
+		return nil, 0
+	}
+	return c.cards[c.i].key, c.cards[c.i].time
+}
+
+// Get the phrase of a studytimes key.
+func (c *memoryChat) getPhrase(key []byte) (Phrase, error) {
+	return c.phrases[phraseIDOf(string(key))], nil
+}
+
+// See findStudy.
+func (c *memoryChat) findStudy(chatID int64, now int64) ([]byte, int64, int, error) {
+	front, waiting := c.frontOfQueue(chatID, time.Unix(now, 0))
+	return pickStudy(now, c.dueCursor(chatID), front, waiting, c.getPhrase)
+}
+
+// GetMode fetches the mode for a chat.
+func (store *Memory) GetMode(chatID int64) (Mode, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	if c.mode == nil {
+		return ModeGetStarted, nil
+	}
+	return *c.mode, nil
+}
+
+// SetMode updates the mode for a chat.
+func (store *Memory) SetMode(chatID int64, mode Mode) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	c.mode = &mode
+	c.modePhrase = 0
+	return nil
+}
+
+// SetModePhrase updates the mode for a chat
+// together with the phrase the mode is about.
+func (store *Memory) SetModePhrase(chatID int64, mode Mode, phraseID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	c.mode = &mode
+	c.modePhrase = phraseID
+	return nil
+}
+
+// GetModePhrase fetches the phrase set together with the mode of a chat.
+// Returns 0 if the mode has been set without a phrase.
+func (store *Memory) GetModePhrase(chatID int64) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.chat(chatID).modePhrase, nil
+}
+
+// AddPhrase stores a new phrase in the current deck of the chat
+// and returns its ID.
+func (store *Memory) AddPhrase(chatID int64, phrase, explanation string, alternatives ...string) (int64, error) {
+	return store.addPhrase(chatID, Phrase{
+		Phrase:       phrase,
+		Alternatives: alternatives,
+		Explanation:  explanation,
+	})
+}
+
+// AddCloze stores a new cloze phrase in the current deck of the chat
+// and returns its ID.
+func (store *Memory) AddCloze(chatID int64, text, explanation string) (int64, error) {
+	if len(clozeIndices(text)) == 0 {
+		return 0, fmt.Errorf("failed to add cloze for chatID %d: %s: %v", chatID, text, ErrNoCloze)
+	}
+	return store.addPhrase(chatID, Phrase{
+		Phrase:      text,
+		Explanation: explanation,
+		Cloze:       true,
+	})
+}
+
+func (store *Memory) addPhrase(chatID int64, p Phrase) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	id, err := store.addPhraseLocked(chatID, p)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add phrase for chatID %d: %s - %s: %v", chatID, p.Phrase, p.Explanation, err)
+	}
+	return id, nil
+}
+
+// Add a phrase to a chat.
+// The store must be locked.
+func (store *Memory) addPhraseLocked(chatID int64, p Phrase) (int64, error) {
+	c := store.chat(chatID)
+	deck, err := c.getDeck(c.getDeckSettings().Current)
+	if err != nil {
+		return 0, err
+	}
+	p.putInDeck(deck)
+	store.phraseSeq++
+	id := store.phraseSeq
+	c.phrases[id] = p.copy()
+	c.putCards(memoryKey(chatID, id), p, time.Now().Add(firstStudytime*time.Hour))
+
+	// Limit number of new studies per day
+	if p.isNew() {
+		c.queued[id] = true
+	}
+	return id, nil
+}
+
+// ImportPhrases adds many phrases to the current deck of the chat at once.
+// See Bolt.ImportPhrases.
+func (store *Memory) ImportPhrases(chatID int64, phrases []Phrase) ([]int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var existing []string
+	for _, p := range store.chat(chatID).phrases {
+		existing = append(existing, p.Explanation)
+	}
+	isDuplicate := duplicateCheck(existing)
+	ids := make([]int64, len(phrases))
+	for i, p := range phrases {
+		if isDuplicate(p) {
+			continue
+		}
+		id, err := store.addPhraseLocked(chatID, p.imported())
+		if err != nil {
+			return nil, fmt.Errorf("failed to import phrases for chatID %d: %v", chatID, err)
+		}
+		c := store.chat(chatID)
+		for _, k := range c.studytimesKeys(memoryKey(chatID, id)) {
+			if next, ok := p.importedStudytime([]byte(k)); ok {
+				c.studytimes[k] = next
+			}
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// GetPhrase returns the phrase with the given ID.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store *Memory) GetPhrase(chatID, phraseID int64) (Phrase, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	p, ok := store.chat(chatID).phrases[phraseID]
+	if !ok {
+		return Phrase{}, ErrPhraseNotFound
+	}
+	return p.copy(), nil
+}
+
+// UpdatePhrase changes the phrase, explanation and alternatives of an existing phrase.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store *Memory) UpdatePhrase(chatID, phraseID int64, phrase, explanation string, alternatives ...string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	p, ok := c.phrases[phraseID]
+	if !ok {
+		return ErrPhraseNotFound
+	}
+	if err := p.edit(phrase, explanation, alternatives); err != nil {
+		return err
+	}
+	p = p.copy()
+	c.phrases[phraseID] = p
+	c.dropUndo(phraseID)
+	c.putCards(memoryKey(chatID, phraseID), p, time.Now().Add(firstStudytime*time.Hour))
+	return nil
+}
+
+// FindPhrase returns a phrase belonging to the passed user that matches the passed function.
+func (store *Memory) FindPhrase(chatID int64, fn func(Phrase) bool) (Phrase, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	for _, id := range c.phraseIDs() {
+		if p := c.phrases[id].copy(); fn(p) {
+			return p, nil
+		}
+	}
+	return Phrase{}, nil
+}
+
+// DeleteStudyPhrase deletes the phrase the passed user currently has to study.
+func (store *Memory) DeleteStudyPhrase(chatID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	key, _, total, err := c.findStudy(chatID, time.Now().Unix())
+	if err == nil && total == 0 {
+		err = errors.New("no study found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete study phrase for chatID %d: %v", chatID, err)
+	}
+	id, _ := btoi(key[8:phraseKeyLen])
+	c.deletePhrase(chatID, id)
+	return nil
+}
+
+// SetPhraseDirection changes the direction a phrase is studied in.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store *Memory) SetPhraseDirection(chatID, phraseID int64, d Direction) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	p, ok := c.phrases[phraseID]
+	if !ok {
+		return ErrPhraseNotFound
+	}
+	if err := p.setDirection(d); err != nil {
+		return err
+	}
+	c.phrases[phraseID] = p
+	c.dropUndo(phraseID)
+	c.putCards(memoryKey(chatID, phraseID), p, time.Now().Add(firstStudytime*time.Hour))
+	return nil
+}
+
+// GetStudy returns the current study the user needs to do.
+func (store *Memory) GetStudy(chatID int64) (Study, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	now := time.Now().Unix()
+	key, keyTime, total, err := c.findStudy(chatID, now)
+	if err != nil {
+		return Study{}, fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
+	}
+	study, err := foundStudy(key, keyTime, total, now, c.getPhrase)
+	if err != nil {
+		return study, fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
+	}
+	return study, nil
+}
+
+// ScoreStudy sets the score of the current study and moves to the next study.
+// Returns true if the phrase has been suspended because of too many lapses.
+func (store *Memory) ScoreStudy(chatID int64, score int, answer Answer) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	now := time.Now()
+	key, _, total, err := c.findStudy(chatID, now.Unix())
+	if err == nil && total == 0 {
+		err = errors.New("no study found")
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
+	}
+	id, _ := btoi(key[8:phraseKeyLen])
+	p := c.phrases[id].copy()
+	snapshot := &memoryUndo{card: string(key), phrase: c.phrases[id], studytime: c.studytimes[string(key)]}
+	if c.queued[id] {
+		delete(c.queued, id)
+		c.addNewCount(now, 1)
+		snapshot.queued = true
+	}
+	r, next, err := store.opts.scoreCard(&p, key, score, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
+	}
+	c.phrases[id] = p
+	c.studytimes[string(key)] = next.Unix()
+	r.ChatID = chatID
+	r.Answer = answer
+	c.reviews = append(c.reviews, r)
+	c.undo = snapshot
+	return p.Suspended, nil
+}
+
+// UndoStudy reverts the latest ScoreStudy of a chat.
+// Returns false if there is nothing to undo.
+func (store *Memory) UndoStudy(chatID int64) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	u := c.undo
+	if u == nil {
+		return false, nil
+	}
+	c.undo = nil
+	id, _ := btoi([]byte(u.card[8:phraseKeyLen]))
+	// Don't bring back cards which have been deleted in the meantime
+	if _, ok := c.phrases[id]; !ok {
+		return false, nil
+	}
+	if _, ok := c.studytimes[u.card]; !ok {
+		return false, nil
+	}
+	c.phrases[id] = u.phrase
+	c.studytimes[u.card] = u.studytime
+	if u.queued {
+		c.queued[id] = true
+		c.addNewCount(time.Now(), -1)
+	}
+	// The latest review belongs to the undone study
+	c.reviews = c.reviews[:len(c.reviews)-1]
+	return true, nil
+}
+
+// GetDistractors returns up to n wrong answers for a study
+// to offer together with the correct answer in a quiz.
+func (store *Memory) GetDistractors(chatID int64, study Study, n int) ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	var phrases []Phrase
+	for _, id := range c.phraseIDs() {
+		phrases = append(phrases, c.phrases[id])
+	}
+	return pickDistractors(study, c.phrases[study.PhraseID].Deck, phrases, n), nil
+}
+
+// GetSuspended returns all suspended phrases of a chat ordered by creation.
+func (store *Memory) GetSuspended(chatID int64) ([]Leech, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	var leeches []Leech
+	for _, id := range c.phraseIDs() {
+		if p := c.phrases[id]; p.Suspended {
+			leeches = append(leeches, Leech{PhraseID: id, Phrase: p.copy()})
+		}
+	}
+	return leeches, nil
+}
+
+// UnsuspendPhrase continues studying a suspended phrase.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store *Memory) UnsuspendPhrase(chatID, phraseID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	p, ok := c.phrases[phraseID]
+	if !ok {
+		return ErrPhraseNotFound
+	}
+	p.unsuspend()
+	c.phrases[phraseID] = p
+	c.dropUndo(phraseID)
+	return nil
+}
+
+// ResetPhrase forgets all progress of a phrase and makes all its studies ready now.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store *Memory) ResetPhrase(chatID, phraseID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	p, ok := c.phrases[phraseID]
+	if !ok {
+		return ErrPhraseNotFound
+	}
+	p.reset()
+	c.phrases[phraseID] = p
+	c.dropUndo(phraseID)
+	now := time.Now().Unix()
+	for _, k := range c.studytimesKeys(memoryKey(chatID, phraseID)) {
+		c.studytimes[k] = now
+	}
+	return nil
+}
+
+// GetReviews returns all reviews of a chat ordered by time.
+func (store *Memory) GetReviews(chatID int64) ([]Review, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	reviews := append([]Review(nil), store.chat(chatID).reviews...)
+	sort.SliceStable(reviews, func(i, j int) bool {
+		return reviews[i].Time.Before(reviews[j].Time)
+	})
+	return reviews, nil
+}
+
+// GetStats calculates the learning statistics of a chat.
+func (store *Memory) GetStats(chatID int64, now time.Time) (Stats, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	var phrases []Phrase
+	for _, p := range c.phrases {
+		phrases = append(phrases, p)
+	}
+	return calcStats(phrases, forecastStudytimes(c.dueCursor(chatID), now), c.reviews, now), nil
+}
+
+// GetDecks returns all decks of a chat ordered by creation.
+func (store *Memory) GetDecks(chatID int64) ([]Deck, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.chat(chatID).getDecks(), nil
+}
+
+// GetDeck returns the deck with the given ID.
+// Returns ErrDeckNotFound if the chat has no deck with the given ID.
+func (store *Memory) GetDeck(chatID, deckID int64) (Deck, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.chat(chatID).getDeck(deckID)
+}
+
+// AddDeck creates a new deck and returns its ID.
+// Returns ErrDeckExists if the chat already has a deck with the same name.
+func (store *Memory) AddDeck(chatID int64, name string) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	for _, d := range c.getDecks() {
+		if d.Name == name {
+			return 0, ErrDeckExists
+		}
+	}
+	store.deckSeq++
+	c.decks[store.deckSeq] = Deck{ID: store.deckSeq, Name: name, Direction: c.getSettings().Direction}
+	return store.deckSeq, nil
+}
+
+// RenameDeck sets a new name for a deck.
+// Returns ErrDeckExists if the chat already has a deck with the same name.
+func (store *Memory) RenameDeck(chatID, deckID int64, name string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	for _, d := range c.getDecks() {
+		if d.Name == name && d.ID != deckID {
+			return ErrDeckExists
+		}
+	}
+	deck, err := c.getDeck(deckID)
+	if err != nil {
+		return err
+	}
+	deck.Name = name
+	c.decks[deckID] = deck
+	return nil
+}
+
+// DeleteDeck removes a deck together with all its phrases.
+func (store *Memory) DeleteDeck(chatID, deckID int64) error {
+	if deckID == DefaultDeck {
+		return ErrDeleteDefaultDeck
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	delete(c.decks, deckID)
+	for id, p := range c.phrases {
+		if p.Deck == deckID {
+			c.deletePhrase(chatID, id)
+		}
+	}
+	if c.deckSettings != nil && c.deckSettings.Current == deckID {
+		c.deckSettings.Current = DefaultDeck
+	}
+	return nil
+}
+
+// SetDeckDirection sets the direction new phrases of a deck are studied in.
+// Returns ErrDeckNotFound if the chat has no deck with the given ID.
+func (store *Memory) SetDeckDirection(chatID, deckID int64, d Direction) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	deck, err := c.getDeck(deckID)
+	if err != nil {
+		return err
+	}
+	deck.Direction = d
+	c.decks[deckID] = deck
+	return nil
+}
+
+// GetDeckSettings returns the deck settings of a chat.
+func (store *Memory) GetDeckSettings(chatID int64) (DeckSettings, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.chat(chatID).getDeckSettings(), nil
+}
+
+// SetDeckSettings updates the deck settings of a chat.
+func (store *Memory) SetDeckSettings(chatID int64, settings DeckSettings) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.chat(chatID).deckSettings = &settings
+	return nil
+}
+
+// GetUserSettings returns the settings of a chat.
+func (store *Memory) GetUserSettings(chatID int64) (UserSettings, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.chat(chatID).getSettings(), nil
+}
+
+// SetUserSettings updates the settings of a chat.
+// Returns ErrInvalidSettings if a value is out of range.
+func (store *Memory) SetUserSettings(chatID int64, settings UserSettings) error {
+	if err := settings.validate(); err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.chat(chatID).settings = &settings
+	return nil
+}
+
+// SpreadBacklog limits the studies due at the given time to UserSettings.BacklogPerDay.
+// See Bolt.SpreadBacklog.
+func (store *Memory) SpreadBacklog(chatID int64, now time.Time) (Backlog, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	day := c.getSettings().day(now)
+	if c.backlogDay == day {
+		return Backlog{}, nil
+	}
+	c.backlogDay = day
+	cards, err := backlogCards(c.dueCursor(chatID), now, c.getPhrase)
+	if err != nil {
+		return Backlog{}, fmt.Errorf("failed to spread backlog of chatID %d: %v", chatID, err)
+	}
+	moved, backlog := spreadBacklog(cards, c.getSettings().BacklogPerDay, now)
+	for _, card := range moved {
+		c.studytimes[string(card.key)] = card.due
+	}
+	return backlog, nil
+}
+
+// GetNotifyTime gets the time until the user should be notified to study.
+// See Bolt.GetNotifyTime.
+func (store *Memory) GetNotifyTime(chatID int64) (time.Duration, int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	if c.pausedSince != nil {
+		return 0, 0, nil
+	}
+	now := time.Now()
+	front, _ := c.frontOfQueue(chatID, now)
+	minCount := c.getSettings().NotifyMinCount
+	d, count := notifyTime(notifyTimestamps(c.dueCursor(chatID), front, minCount, now), minCount, now)
+	return d, count, nil
+}
+
+// EachActiveChat runs a function for each chat
+// where the user has been active since the last notification has been sent.
+func (store *Memory) EachActiveChat(fn func(int64)) error {
+	store.mu.Lock()
+	var ids []int64
+	for id, c := range store.chats {
+		if c.read != nil && *c.read > c.activity {
+			ids = append(ids, id)
+		}
+	}
+	// fn might use the store
+	store.mu.Unlock()
+	for _, id := range ids {
+		fn(id)
+	}
+	return nil
+}
+
+// SetActivity sets the last time a message was sent to a user.
+func (store *Memory) SetActivity(chatID int64, t time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.chat(chatID).activity = t.Unix()
+	return nil
+}
+
+// SetRead sets the last time the user read a message.
+func (store *Memory) SetRead(chatID int64, t time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	read := t.Unix()
+	store.chat(chatID).read = &read
+	return nil
+}
+
+// IsSubscribed checks if a user has notifications enabled.
+func (store *Memory) IsSubscribed(chatID int64) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.chat(chatID).subscribed, nil
+}
+
+// Subscribe enables notifications for a user.
+func (store *Memory) Subscribe(chatID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.chat(chatID).subscribed = true
+	return nil
+}
+
+// Unsubscribe disables notifications for a user.
+func (store *Memory) Unsubscribe(chatID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.chat(chatID).subscribed = false
+	return nil
+}
+
+// Pause stops the schedule of a chat while the user is away.
+// See Bolt.Pause.
+func (store *Memory) Pause(chatID int64, t time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	if c.pausedSince == nil {
+		since := t.Unix()
+		c.pausedSince = &since
+	}
+	return nil
+}
+
+// PausedSince returns the start of the pause of a chat.
+// Returns the zero time if the chat is not paused.
+func (store *Memory) PausedSince(chatID int64) (time.Time, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	if c.pausedSince == nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(*c.pausedSince, 0), nil
+}
+
+// Resume ends the pause of a chat and moves all its study times.
+// See Bolt.Resume.
+func (store *Memory) Resume(chatID int64, t time.Time) (time.Duration, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	c := store.chat(chatID)
+	if c.pausedSince == nil {
+		return 0, nil
+	}
+	paused := t.Sub(time.Unix(*c.pausedSince, 0))
+	c.pausedSince = nil
+	if paused <= 0 {
+		return paused, nil
+	}
+	shift := int64(paused / time.Second)
+	for k := range c.studytimes {
+		c.studytimes[k] += shift
+	}
+	return paused, nil
+}
+
+// BackupTo responds with an error since there is no database file to back up.
+func (store *Memory) BackupTo(w http.ResponseWriter) {
+	http.Error(w, "backups are not supported by the in-memory store", http.StatusNotImplemented)
+}
+
+// StudyNow resets all study times of all users to now.
+func (store *Memory) StudyNow() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now().Unix()
+	for _, c := range store.chats {
+		for k := range c.studytimes {
+			c.studytimes[k] = now
+		}
+	}
+	return nil
+}
+
+// DeleteChat removes all records of a given chat.
+func (store *Memory) DeleteChat(chatID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.chats, chatID)
+	return nil
+}
+
+// GetChatIDs returns chatIDs of all users.
+func (store *Memory) GetChatIDs() ([]int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var ids []int64
+	for id, c := range store.chats {
+		if c.mode != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Export writes all phrases of a chat in the given format.
+// Returns ErrUnknownFormat if the format is not supported.
+func (store *Memory) Export(chatID int64, format Format, w io.Writer) error {
+	store.mu.Lock()
+	c := store.chat(chatID)
+	decks := c.getDecks()
+	reviews := map[int64][]Review{}
+	for _, r := range c.reviews {
+		reviews[r.PhraseID] = append(reviews[r.PhraseID], r)
+	}
+	var phrases []exportedPhrase
+	for _, id := range c.phraseIDs() {
+		var studytimes []int64
+		for _, k := range c.studytimesKeys(memoryKey(chatID, id)) {
+			studytimes = append(studytimes, c.studytimes[k])
+		}
+		phrases = append(phrases, newExportedPhrase(id, c.phrases[id].copy(), decks, studytimes, reviews[id]))
+	}
+	// Writing might be slow
+	store.mu.Unlock()
+	return writeExport(w, format, phrases)
+}
+
+// DeletePhrases removes all phrases fn matches.
+func (store *Memory) DeletePhrases(fn func(int64, Phrase) bool) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deleted := 0
+	for chatID, c := range store.chats {
+		for id, p := range c.phrases {
+			if fn(chatID, p.copy()) {
+				c.deletePhrase(chatID, id)
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// Close does nothing since there are no resources to release.
+func (store *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,26 @@
+package brain_test
+
+import (
+	"testing"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/brain/storetest"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func() brain.Store { return brain.NewMemory() })
+}
+
+func TestMemoryOptions(t *testing.T) {
+	storetest.RunOptions(t, func(options ...func(*brain.Options)) brain.Store {
+		return brain.NewMemory(options...)
+	})
+}
+
+func BenchmarkMemoryGetStudy(b *testing.B) {
+	storetest.BenchmarkGetStudy(b, func() brain.Store { return brain.NewMemory() })
+}
+
+func BenchmarkMemoryGetStudySkipped(b *testing.B) {
+	storetest.BenchmarkGetStudySkipped(b, func() brain.Store { return brain.NewMemory() })
+}
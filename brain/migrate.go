@@ -0,0 +1,293 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Key in bucketMeta of the schema version of the database
+var keyVersion = []byte("version")
+
+// ErrSchemaTooNew is returned when a database has been migrated by a newer version of the bot.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+// Returned from a dry run to roll back the transaction
+var errDryRun = errors.New("dry run")
+
+// A migration changes the data of a database from one schema version to the next.
+// Migrations are never removed or reordered;
+// a change of the data format is done by appending a new migration.
+// The schema version of a database is the number of migrations run on it.
+type migration struct {
+	description string
+	migrate     func(tx *bolt.Tx) error
+}
+
+var migrations = []migration{
+	{
+		// Databases created before schema versions existed already use this format.
+		description: "record schema version",
+		migrate:     func(*bolt.Tx) error { return nil },
+	},
+	{
+		// The index is built again by the next migration with big-endian keys.
+		description: "index study times by due time",
+		migrate:     indexStudytimes,
+	},
+	{
+		description: "store integers in big-endian order",
+		migrate:     migrateBigEndian,
+	},
+	{
+		description: "queue phrases never studied",
+		migrate:     queueNewPhrases,
+	},
+	{
+		description: "leave queued phrases out of the due index",
+		migrate:     reindexStudytimes,
+	},
+	{
+		description: "index due studies by deck and leave out suspended phrases",
+		migrate:     reindexStudytimes,
+	},
+}
+
+// Latest schema version
+func latestVersion() int64 {
+	return int64(len(migrations))
+}
+
+// The version keeps the encoding of the first schema versions
+// so that it can be read by every version of the bot.
+func getVersion(tx *bolt.Tx) (int64, error) {
+	b := tx.Bucket(bucketMeta)
+	if b == nil {
+		return 0, nil
+	}
+	v := b.Get(keyVersion)
+	if v == nil {
+		return 0, nil
+	}
+	return varintBtoi(v)
+}
+
+func putVersion(tx *bolt.Tx, version int64) error {
+	return tx.Bucket(bucketMeta).Put(keyVersion, varintItob(version))
+}
+
+// SchemaVersion returns the current and the latest schema version of the database.
+func (store Bolt) SchemaVersion() (int64, int64, error) {
+	var version int64
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = getVersion(tx)
+		return err
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get schema version: %v", err)
+	}
+	return version, latestVersion(), nil
+}
+
+// Migrate updates the database to the latest schema version.
+// All pending migrations run in a single transaction;
+// if one of them fails, the database is left unchanged.
+// Before changing anything, a backup is written next to the database file.
+// In a dry run the migrations run but all changes are rolled back.
+// Returns the descriptions of the migrations that have been run.
+func (store Bolt) Migrate(dryRun bool) ([]string, error) {
+	version, latest, err := store.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > latest {
+		return nil, fmt.Errorf("failed to migrate database from version %d to %d: %v", version, latest, ErrSchemaTooNew)
+	}
+	if version == latest {
+		return nil, nil
+	}
+
+	if !dryRun {
+		backup := fmt.Sprintf("%s.v%d.%s.bak", store.db.Path(), version, time.Now().Format("20060102150405"))
+		err := store.db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(backup, 0600)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to write backup before migration to %s: %v", backup, err)
+		}
+	}
+
+	var done []string
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		// Stores from Open might not have the buckets of the latest version yet
+		if err := createBuckets(tx); err != nil {
+			return err
+		}
+		for i := version; i < latest; i++ {
+			m := migrations[i]
+			if err := m.migrate(tx); err != nil {
+				return fmt.Errorf("migration to version %d (%s): %v", i+1, m.description, err)
+			}
+			done = append(done, fmt.Sprintf("version %d: %s", i+1, m.description))
+		}
+		if err := putVersion(tx, latest); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, fmt.Errorf("failed to migrate database from version %d to %d: %v", version, latest, err)
+	}
+	return done, nil
+}
+
+// Integers used to be stored as zig-zag varints padded to 8 bytes.
+func varintItob(v int64) []byte {
+	b := make([]byte, 8)
+	binary.PutVarint(b, v)
+	return b
+}
+
+func varintBtoi(b []byte) (int64, error) {
+	return binary.ReadVarint(bytes.NewBuffer(b))
+}
+
+// Convert the integers of a key from varint to big-endian.
+// Keys start with the chat ID, optionally followed by a second ID
+// and a suffix which is kept as it is.
+func bigEndianKey(k []byte, ids int) ([]byte, error) {
+	if len(k) < ids*8 {
+		return nil, fmt.Errorf("key %x too short", k)
+	}
+	key := make([]byte, 0, len(k))
+	for i := 0; i < ids; i++ {
+		v, err := varintBtoi(k[i*8 : (i+1)*8])
+		if err != nil {
+			return nil, fmt.Errorf("key %x: %v", k, err)
+		}
+		key = append(key, itob(v)...)
+	}
+	return append(key, k[ids*8:]...), nil
+}
+
+func bigEndianValue(v []byte) ([]byte, error) {
+	i, err := varintBtoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("value %x: %v", v, err)
+	}
+	return itob(i), nil
+}
+
+// Replace all keys and values of a bucket with converted ones.
+// The bucket itself is kept so its sequence doesn't change.
+func rewriteBucket(tx *bolt.Tx, bucket []byte, fn func(k, v []byte) ([]byte, []byte, error)) error {
+	b := tx.Bucket(bucket)
+	var keys, newKeys, newValues [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		newKey, newValue, err := fn(k, v)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, append([]byte(nil), k...))
+		newKeys = append(newKeys, newKey)
+		newValues = append(newValues, append([]byte(nil), newValue...))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bucket '%s': %v", bucket, err)
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	for i, k := range newKeys {
+		if err := b.Put(k, newValues[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Convert all integers in keys and values from varint to big-endian
+// and rebuild the due index with the new keys.
+func migrateBigEndian(tx *bolt.Tx) error {
+	buckets := []struct {
+		name []byte
+		// Number of IDs at the start of the keys
+		ids int
+		// Whether the values are integers
+		intValue bool
+	}{
+		{bucketModes, 1, true},
+		{bucketPhrases, 2, false},
+		{bucketStudytimes, 2, true},
+		{bucketReads, 1, true},
+		{bucketActivities, 1, true},
+		{bucketSubscriptions, 1, false},
+		{bucketReviews, 2, false},
+		{bucketDecks, 2, false},
+		{bucketDeckSettings, 1, false},
+	}
+	for _, bucket := range buckets {
+		ids, intValue := bucket.ids, bucket.intValue
+		err := rewriteBucket(tx, bucket.name, func(k, v []byte) ([]byte, []byte, error) {
+			key, err := bigEndianKey(k, ids)
+			if err != nil || !intValue {
+				return key, v, err
+			}
+			value, err := bigEndianValue(v)
+			return key, value, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Undos contain keys and a study time
+	err := rewriteBucket(tx, bucketUndos, func(k, v []byte) ([]byte, []byte, error) {
+		key, err := bigEndianKey(k, 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		var u undo
+		if err := json.Unmarshal(v, &u); err != nil {
+			return nil, nil, err
+		}
+		if u.Card, err = bigEndianKey(u.Card, 2); err != nil {
+			return nil, nil, err
+		}
+		if u.Studytime != nil {
+			if u.Studytime, err = bigEndianValue(u.Studytime); err != nil {
+				return nil, nil, err
+			}
+		}
+		if u.Review != nil {
+			if u.Review, err = bigEndianKey(u.Review, 2); err != nil {
+				return nil, nil, err
+			}
+		}
+		buf, err := json.Marshal(u)
+		return key, buf, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.DeleteBucket(bucketDue); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucket(bucketDue); err != nil {
+		return err
+	}
+	return indexStudytimes(tx)
+}
@@ -0,0 +1,70 @@
+package brain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestOpenMissing(t *testing.T) {
+	store, cleanup := openTestBolt(t)
+	defer cleanup()
+	file := filepath.Join(filepath.Dir(store.db.Path()), "missing.db")
+	if _, err := Open(file); err == nil {
+		t.Error("expected error for missing database")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected database not to be created, got %v", err)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	store, cleanup := openTestBolt(t)
+	defer cleanup()
+	file := filepath.Join(filepath.Dir(store.db.Path()), "old.db")
+
+	// Databases created before schema versions only have some of the buckets
+	db, err := bolt.Open(file, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(bucketModes)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	done, err := old.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) {
+		t.Errorf("expected %d migrations, got %q", len(migrations), done)
+	}
+	err = old.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if string(name) != string(bucketModes) {
+				t.Errorf("expected dry run not to create bucket %s", name)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _, err := old.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("expected version 0 after dry run, got %d: %v", version, err)
+	}
+}
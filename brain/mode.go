@@ -7,11 +7,13 @@ import (
 )
 
 // GetMode fetches the mode for a chat.
-func (store Store) GetMode(chatID int64) (Mode, error) {
+// The mode is stored as big-endian integer,
+// followed by the phrase ID if set with SetModePhrase.
+func (store Bolt) GetMode(chatID int64) (Mode, error) {
 	var mode Mode
 	err := store.db.View(func(tx *bolt.Tx) error {
 		if bm := tx.Bucket(bucketModes).Get(itob(chatID)); bm != nil {
-			iMode, err := btoi(bm)
+			iMode, err := btoi(bm[:8])
 			if err != nil {
 				return err
 			}
@@ -28,7 +30,7 @@ func (store Store) GetMode(chatID int64) (Mode, error) {
 }
 
 // SetMode updates the mode for a chat.
-func (store Store) SetMode(chatID int64, mode Mode) error {
+func (store Bolt) SetMode(chatID int64, mode Mode) error {
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		return tx.Bucket(bucketModes).Put(itob(chatID), itob(int64(mode)))
 	})
@@ -37,3 +39,35 @@ func (store Store) SetMode(chatID int64, mode Mode) error {
 	}
 	return nil
 }
+
+// SetModePhrase updates the mode for a chat
+// together with the phrase the mode is about,
+// like the phrase edited in ModeEditLeech.
+func (store Bolt) SetModePhrase(chatID int64, mode Mode, phraseID int64) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketModes).Put(itob(chatID), append(itob(int64(mode)), itob(phraseID)...))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set mode for chatID %d: %d with phrase %d: %v", chatID, mode, phraseID, err)
+	}
+	return nil
+}
+
+// GetModePhrase fetches the phrase set together with the mode of a chat.
+// Returns 0 if the mode has been set without a phrase.
+func (store Bolt) GetModePhrase(chatID int64) (int64, error) {
+	var phraseID int64
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bm := tx.Bucket(bucketModes).Get(itob(chatID))
+		if len(bm) != 16 {
+			return nil
+		}
+		var err error
+		phraseID, err = btoi(bm[8:])
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get mode phrase for chatID %d: %v", chatID, err)
+	}
+	return phraseID, nil
+}
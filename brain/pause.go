@@ -0,0 +1,98 @@
+package brain
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Pause stops the schedule of a chat while the user is away.
+// No notifications are due until the chat is resumed.
+// Pausing a paused chat keeps the original start of the pause.
+func (store Bolt) Pause(chatID int64, t time.Time) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketPauses)
+		if b.Get(itob(chatID)) != nil {
+			return nil
+		}
+		return b.Put(itob(chatID), itob(t.Unix()))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pause chatID %d: %v", chatID, err)
+	}
+	return nil
+}
+
+// PausedSince returns the start of the pause of a chat.
+// Returns the zero time if the chat is not paused.
+func (store Bolt) PausedSince(chatID int64) (time.Time, error) {
+	var since time.Time
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		since, err = pausedSince(tx, chatID)
+		return err
+	})
+	if err != nil {
+		return since, fmt.Errorf("failed to get pause of chatID %d: %v", chatID, err)
+	}
+	return since, nil
+}
+
+func pausedSince(tx *bolt.Tx, chatID int64) (time.Time, error) {
+	v := tx.Bucket(bucketPauses).Get(itob(chatID))
+	if v == nil {
+		return time.Time{}, nil
+	}
+	t, err := btoi(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(t, 0), nil
+}
+
+// Resume ends the pause of a chat.
+// All study times of the chat are moved by the duration of the pause
+// so the intervals between studies stay the same.
+// Returns the duration of the pause; 0 if the chat was not paused.
+func (store Bolt) Resume(chatID int64, t time.Time) (time.Duration, error) {
+	var paused time.Duration
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		since, err := pausedSince(tx, chatID)
+		if err != nil || since.IsZero() {
+			return err
+		}
+		if err := tx.Bucket(bucketPauses).Delete(itob(chatID)); err != nil {
+			return err
+		}
+		paused = t.Sub(since)
+		if paused <= 0 {
+			return nil
+		}
+		// Collect study times first since they are changed while moving them
+		var keys [][]byte
+		var times []int64
+		prefix := itob(chatID)
+		c := tx.Bucket(bucketStudytimes).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			studytime, err := btoi(v)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			times = append(times, studytime)
+		}
+		shift := int64(paused / time.Second)
+		for i, k := range keys {
+			if err := putStudytime(tx, k, times[i]+shift); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to resume chatID %d: %v", chatID, err)
+	}
+	return paused, nil
+}
@@ -10,57 +10,178 @@ import (
 	"github.com/boltdb/bolt"
 )
 
-// AddPhrase stores a new phrase.
-func (store Store) AddPhrase(chatID int64, phrase, explanation string) error {
+// AddPhrase stores a new phrase in the current deck of the chat
+// and returns its ID.
+// Alternatives are accepted as answers besides the phrase.
+// The phrase is studied in the direction set for the deck.
+func (store Bolt) AddPhrase(chatID int64, phrase, explanation string, alternatives ...string) (int64, error) {
+	return store.addPhrase(chatID, Phrase{
+		Phrase:       phrase,
+		Alternatives: alternatives,
+		Explanation:  explanation,
+	})
+}
+
+// AddCloze stores a new cloze phrase in the current deck of the chat
+// and returns its ID.
+// The text contains cloze deletions like {{c1::word}}.
+// Each cloze index is studied separately.
+// The explanation is optional and displayed together with the text.
+func (store Bolt) AddCloze(chatID int64, text, explanation string) (int64, error) {
+	if len(clozeIndices(text)) == 0 {
+		return 0, fmt.Errorf("failed to add cloze for chatID %d: %s: %v", chatID, text, ErrNoCloze)
+	}
+	return store.addPhrase(chatID, Phrase{
+		Phrase:      text,
+		Explanation: explanation,
+		Cloze:       true,
+	})
+}
+
+func (store Bolt) addPhrase(chatID int64, p Phrase) (int64, error) {
+	var id int64
 	err := store.db.Update(func(tx *bolt.Tx) error {
-		bp := tx.Bucket(bucketPhrases)
+		var err error
+		id, err = addPhrase(tx, chatID, p)
+		return err
+	})
 
-		// Get phrase id
-		sequence, err := bp.NextSequence()
-		if err != nil {
-			return err
+	if err != nil {
+		return id, fmt.Errorf("failed to add phrase for chatID %d: %s - %s: %v", chatID, p.Phrase, p.Explanation, err)
+	}
+	return id, nil
+}
+
+func addPhrase(tx *bolt.Tx, chatID int64, p Phrase) (int64, error) {
+	bp := tx.Bucket(bucketPhrases)
+
+	// Get phrase id
+	sequence, err := bp.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	id := int64(sequence)
+	prefix := itob(chatID)
+	phraseID := append(prefix, itob(id)...)
+
+	// Phrase to JSON
+	settings, err := getDeckSettings(tx, chatID)
+	if err != nil {
+		return id, err
+	}
+	deck, err := getDeck(tx, chatID, settings.Current)
+	if err != nil {
+		return id, err
+	}
+	p.putInDeck(deck)
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return id, err
+	}
+
+	// Save Phrase
+	if err = bp.Put(phraseID, buf); err != nil {
+		return id, err
+	}
+
+	// Save study time
+	now := time.Now()
+	if err := putCards(tx, phraseID, p, now.Add(firstStudytime*time.Hour)); err != nil {
+		return id, err
+	}
+
+	// Limit number of new studies per day
+	if !p.isNew() {
+		return id, nil
+	}
+	return id, queuePhrase(tx, phraseID, now)
+}
+
+// Put a new phrase into a deck.
+// Phrases are studied in the direction of their deck;
+// cloze phrases have no direction.
+func (p *Phrase) putInDeck(deck Deck) {
+	p.Deck = deck.ID
+	if !p.Cloze {
+		p.Direction = deck.Direction
+	}
+}
+
+// GetPhrase returns the phrase with the given ID.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store Bolt) GetPhrase(chatID, phraseID int64) (Phrase, error) {
+	var p Phrase
+	err := store.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketPhrases).Get(append(itob(chatID), itob(phraseID)...))
+		if v == nil {
+			return ErrPhraseNotFound
 		}
-		prefix := itob(chatID)
-		phraseID := append(prefix, itob(int64(sequence))...)
+		return json.Unmarshal(v, &p)
+	})
+	if err == ErrPhraseNotFound {
+		return p, err
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to get phrase %d for chatID %d: %v", phraseID, chatID, err)
+	}
+	return p, nil
+}
 
-		// Phrase to JSON
-		buf, err := json.Marshal(Phrase{Phrase: phrase, Explanation: explanation})
+// UpdatePhrase changes the phrase, explanation and alternatives of an existing phrase.
+// Score and study times are kept.
+// For cloze phrases, studies of new cloze indices are added
+// and studies of removed indices are deleted.
+// Returns ErrPhraseNotFound if the chat has no phrase with the given ID.
+func (store Bolt) UpdatePhrase(chatID, phraseID int64, phrase, explanation string, alternatives ...string) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bp := tx.Bucket(bucketPhrases)
+		key := append(itob(chatID), itob(phraseID)...)
+		v := bp.Get(key)
+		if v == nil {
+			return ErrPhraseNotFound
+		}
+		var p Phrase
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		if err := p.edit(phrase, explanation, alternatives); err != nil {
+			return err
+		}
+		buf, err := json.Marshal(p)
 		if err != nil {
 			return err
 		}
-
-		// Save Phrase
-		if err = bp.Put(phraseID, buf); err != nil {
+		if err := bp.Put(key, buf); err != nil {
 			return err
 		}
-
-		// Limit number of new studies per day
-		newPhrases := 0
-		c := tx.Bucket(bucketPhrases).Cursor()
-		var p Phrase
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
-			if err := json.Unmarshal(v, &p); err != nil {
-				return err
-			}
-			if p.Score == 0 {
-				newPhrases++
-			}
+		if err := dropUndo(tx, key); err != nil {
+			return err
 		}
-
-		// Save study time
-		bs := tx.Bucket(bucketStudytimes)
-		next := itob(time.Now().Add(time.Duration(newPhrases/newPerDay*24+firstStudytime) * time.Hour).Unix())
-		return bs.Put(phraseID, next)
+		return putCards(tx, key, p, time.Now().Add(firstStudytime*time.Hour))
 	})
-
+	if err == ErrPhraseNotFound || err == ErrNoCloze {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to add phrase for chatID %d: %s - %s: %v", chatID, phrase, explanation, err)
+		return fmt.Errorf("failed to update phrase %d for chatID %d: %s - %s: %v", phraseID, chatID, phrase, explanation, err)
 	}
 	return nil
 }
 
+// Change the phrase, explanation and alternatives of a phrase.
+// Returns ErrNoCloze if a cloze phrase is left without cloze.
+func (p *Phrase) edit(phrase, explanation string, alternatives []string) error {
+	if p.Cloze && len(clozeIndices(phrase)) == 0 {
+		return ErrNoCloze
+	}
+	p.Phrase = phrase
+	p.Alternatives = alternatives
+	p.Explanation = explanation
+	return nil
+}
+
 // FindPhrase returns a phrase belonging to the passed user that matches the passed function.
-func (store Store) FindPhrase(chatID int64, fn func(Phrase) bool) (Phrase, error) {
+func (store Bolt) FindPhrase(chatID int64, fn func(Phrase) bool) (Phrase, error) {
 	var p Phrase
 	err := store.db.View(func(tx *bolt.Tx) error {
 		c := tx.Bucket(bucketPhrases).Cursor()
@@ -85,36 +206,24 @@ func (store Store) FindPhrase(chatID int64, fn func(Phrase) bool) (Phrase, error
 }
 
 // DeleteStudyPhrase deletes the phrase the passed user currently has to study.
-func (store Store) DeleteStudyPhrase(chatID int64) error {
+func (store Bolt) DeleteStudyPhrase(chatID int64) error {
 	err := store.db.Update(func(tx *bolt.Tx) error {
-		bs := tx.Bucket(bucketStudytimes)
-		c := bs.Cursor()
-		now := time.Now().Unix()
-		prefix := itob(chatID)
-		var keyTime int64
-		var key []byte
-
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
-			timestamp, err := btoi(v)
-			if err != nil {
-				return err
-			}
-			if timestamp > now {
-				continue
-			}
-			if timestamp < keyTime || keyTime == 0 {
-				keyTime = timestamp
-				key = k
-			}
+		key, _, total, err := findStudy(tx, chatID, time.Now().Unix())
+		if err != nil {
+			return err
 		}
 
 		// No studies found
-		if key == nil {
+		if total == 0 {
 			return errors.New("no study found")
 		}
 
-		// Delete study time
-		if err := bs.Delete(key); err != nil {
+		// Delete study times of all directions
+		key = phraseKey(key)
+		if err := deleteStudytimes(tx, key); err != nil {
+			return err
+		}
+		if err := dropUndo(tx, key); err != nil {
 			return err
 		}
 
@@ -0,0 +1,262 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// New phrases wait in a queue until they are studied for the first time.
+// Each day only UserSettings.NewPerDay phrases are taken from the queue,
+// in the order they have been added.
+// This way adding or importing many phrases at once doesn't flood the studies.
+
+// Format of a day in newCount
+const dayFormat = "2006-01-02"
+
+// Number of phrases taken from the queue on a day
+type newCount struct {
+	// Day is the date in the timezone of the user.
+	Day   string
+	Count int
+}
+
+// Get the number of phrases taken from the queue on the given day.
+func (c newCount) on(day string) int {
+	if c.Day != day {
+		return 0
+	}
+	return c.Count
+}
+
+// Change the number of phrases taken from the queue on the given day by n.
+func (c newCount) add(day string, n int) newCount {
+	count := c.on(day) + n
+	if count < 0 {
+		count = 0
+	}
+	return newCount{Day: day, Count: count}
+}
+
+// Get the date of t in the timezone of the user.
+func (s UserSettings) day(t time.Time) string {
+	return t.In(s.location()).Format(dayFormat)
+}
+
+// Get the start of the day after t in the timezone of the user.
+func (s UserSettings) nextDay(t time.Time) time.Time {
+	return startOfDay(t.In(s.location())).AddDate(0, 0, 1)
+}
+
+func (s UserSettings) location() *time.Location {
+	return time.FixedZone("", int(s.Timezone*60*60))
+}
+
+// Check if a phrase has never been studied.
+func (p Phrase) isNew() bool {
+	for _, state := range p.cardStates() {
+		if !state.Reviewed.IsZero() || state.Score != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add a phrase to the end of the queue of new phrases.
+// Its cards are removed from the due index.
+func queuePhrase(tx *bolt.Tx, key []byte, now time.Time) error {
+	if err := tx.Bucket(bucketNewQueue).Put(key, itob(now.Unix())); err != nil {
+		return err
+	}
+	return unindexPhrase(tx, key)
+}
+
+// Check if the phrase of a studytimes key is in the queue of new phrases.
+func isQueued(tx *bolt.Tx, key []byte) bool {
+	return tx.Bucket(bucketNewQueue).Get(phraseKey(key)) != nil
+}
+
+// Get the number of phrases taken from the queue on the given day.
+func getNewCount(tx *bolt.Tx, chatID int64, day string) (int, error) {
+	v := tx.Bucket(bucketNewCounts).Get(itob(chatID))
+	if v == nil {
+		return 0, nil
+	}
+	var count newCount
+	if err := json.Unmarshal(v, &count); err != nil {
+		return 0, err
+	}
+	return count.on(day), nil
+}
+
+// Change the number of phrases taken from the queue on the given day by n.
+func addNewCount(tx *bolt.Tx, chatID int64, day string, n int) error {
+	var count newCount
+	if v := tx.Bucket(bucketNewCounts).Get(itob(chatID)); v != nil {
+		if err := json.Unmarshal(v, &count); err != nil {
+			return err
+		}
+	}
+	buf, err := json.Marshal(count.add(day, n))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketNewCounts).Put(itob(chatID), buf)
+}
+
+// Take the phrase of a studytimes key from the queue of new phrases
+// and count it for the day of now.
+// Returns false if the phrase is not queued.
+func takeFromQueue(tx *bolt.Tx, chatID int64, key []byte, now time.Time) (bool, error) {
+	if !isQueued(tx, key) {
+		return false, nil
+	}
+	if err := tx.Bucket(bucketNewQueue).Delete(phraseKey(key)); err != nil {
+		return false, err
+	}
+	if err := indexPhrase(tx, phraseKey(key)); err != nil {
+		return false, err
+	}
+	settings, err := getUserSettings(tx, chatID)
+	if err != nil {
+		return false, err
+	}
+	return true, addNewCount(tx, chatID, settings.day(now), 1)
+}
+
+// Put the phrase of a studytimes key back to the queue of new phrases
+// and don't count it for the day of now anymore.
+func returnToQueue(tx *bolt.Tx, chatID int64, key []byte, now time.Time) error {
+	if err := queuePhrase(tx, phraseKey(key), now); err != nil {
+		return err
+	}
+	settings, err := getUserSettings(tx, chatID)
+	if err != nil {
+		return err
+	}
+	return addNewCount(tx, chatID, settings.day(now), -1)
+}
+
+// Get the cards of the phrases at the front of the queue of new phrases
+// which can be studied at the given time.
+// Only queued phrases the filter inDeck accepts are considered.
+// See queueFront.
+func frontOfQueue(tx *bolt.Tx, chatID int64, now time.Time, inDeck func([]byte) (bool, error)) ([]dueCard, *dueCard, error) {
+	settings, err := getUserSettings(tx, chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	count, err := getNewCount(tx, chatID, settings.day(now))
+	if err != nil {
+		return nil, nil, err
+	}
+	bs := tx.Bucket(bucketStudytimes)
+	c := tx.Bucket(bucketNewQueue).Cursor()
+	prefix := itob(chatID)
+	k, _ := c.Seek(prefix)
+	next := func() ([]dueCard, bool, error) {
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ok, err := inDeck(k)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				continue
+			}
+			var cards []dueCard
+			for _, key := range studytimesKeys(tx, k) {
+				t, err := btoi(bs.Get(key))
+				if err != nil {
+					return nil, false, err
+				}
+				cards = append(cards, dueCard{key: key, time: t})
+			}
+			k, _ = c.Next()
+			return cards, true, nil
+		}
+		return nil, false, nil
+	}
+	return queueFront(settings, count, now, next)
+}
+
+// Split the queue of new phrases into the cards which can be studied at the given time
+// and the card waiting next.
+// count is the number of phrases taken from the queue on the day of now.
+// next returns the cards of the queued phrases one phrase after another in queue order
+// and false once the queue has been read.
+// Only until UserSettings.NewPerDay phrases have been taken from the queue that day,
+// their cards can be studied.
+// If more phrases are waiting, the earliest card of the next one is returned as well,
+// with a study time not before the next day.
+// It is nil if no more phrases are waiting.
+// The queue is read only up to that phrase.
+func queueFront(settings UserSettings, count int, now time.Time, next func() ([]dueCard, bool, error)) ([]dueCard, *dueCard, error) {
+	remaining := settings.NewPerDay - count
+	var front []dueCard
+	for {
+		cards, ok, err := next()
+		if err != nil || !ok {
+			return front, nil, err
+		}
+		if remaining > 0 {
+			front = append(front, cards...)
+			remaining--
+			continue
+		}
+		if len(cards) == 0 {
+			continue
+		}
+		waiting := cards[0]
+		for _, card := range cards[1:] {
+			if card.time < waiting.time {
+				waiting = card
+			}
+		}
+		if nextDay := settings.nextDay(now).Unix(); waiting.time < nextDay {
+			waiting.time = nextDay
+		}
+		return front, &waiting, nil
+	}
+}
+
+// Put all phrases that have never been studied into the queue of new phrases.
+// Their study times used to be delayed by a day for every NewPerDay new phrases;
+// they are due now so the queue decides when they are studied.
+func queueNewPhrases(tx *bolt.Tx) error {
+	now := time.Now()
+	var keys [][]byte
+	err := tx.Bucket(bucketPhrases).ForEach(func(k, v []byte) error {
+		var p Phrase
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		if p.isNew() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bs := tx.Bucket(bucketStudytimes)
+	for _, key := range keys {
+		if err := queuePhrase(tx, key, now); err != nil {
+			return err
+		}
+		for _, k := range studytimesKeys(tx, key) {
+			studytime, err := btoi(bs.Get(k))
+			if err != nil {
+				return err
+			}
+			if studytime <= now.Unix() {
+				continue
+			}
+			if err := putStudytime(tx, k, now.Unix()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
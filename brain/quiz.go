@@ -0,0 +1,106 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/jorinvo/studybot/grade"
+)
+
+// GetDistractors returns up to n wrong answers for a study
+// to offer together with the correct answer in a quiz.
+// They are taken from the other phrases of the chat.
+// Phrases of the same deck and answers of similar length are preferred.
+// Fewer distractors are returned if the chat doesn't have enough phrases.
+func (store Bolt) GetDistractors(chatID int64, study Study, n int) ([]string, error) {
+	var distractors []string
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bp := tx.Bucket(bucketPhrases)
+		prefix := itob(chatID)
+		var current Phrase
+		if v := bp.Get(append(itob(chatID), itob(study.PhraseID)...)); v != nil {
+			if err := json.Unmarshal(v, &current); err != nil {
+				return err
+			}
+		}
+		var phrases []Phrase
+		c := bp.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var p Phrase
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			phrases = append(phrases, p)
+		}
+		distractors = pickDistractors(study, current.Deck, phrases, n)
+		return nil
+	})
+	if err != nil {
+		return distractors, fmt.Errorf("failed to get distractors for phrase %d with chatID %d: %v", study.PhraseID, chatID, err)
+	}
+	return distractors, nil
+}
+
+// Pick up to n distractors for a study in the given deck from the phrases of a chat.
+func pickDistractors(study Study, deck int64, phrases []Phrase, n int) []string {
+	// Answers of the study must not be offered as distractors
+	seen := map[string]bool{}
+	for _, s := range append([]string{study.Phrase}, study.Alternatives...) {
+		seen[grade.Norm(s)] = true
+	}
+
+	type candidate struct {
+		answer   string
+		sameDeck bool
+		lenDiff  int
+	}
+	var candidates []candidate
+	add := func(answer string, d int64) {
+		norm := grade.Norm(answer)
+		if norm == "" || seen[norm] {
+			return
+		}
+		seen[norm] = true
+		diff := len([]rune(answer)) - len([]rune(study.Phrase))
+		if diff < 0 {
+			diff = -diff
+		}
+		candidates = append(candidates, candidate{answer, d == deck, diff})
+	}
+
+	for _, p := range phrases {
+		switch {
+		// Gaps of cloze texts can only be mixed into forward and cloze studies
+		case p.Cloze && !study.Reverse:
+			for _, i := range clozeIndices(p.Phrase) {
+				_, answer := renderCloze(p.Phrase, i)
+				add(answer, p.Deck)
+			}
+		case p.Cloze:
+		case study.Reverse:
+			add(p.Explanation, p.Deck)
+		default:
+			add(p.Phrase, p.Deck)
+		}
+	}
+
+	// Shuffle first so candidates that rank the same are picked randomly
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].sameDeck != candidates[j].sameDeck {
+			return candidates[i].sameDeck
+		}
+		return candidates[i].lenDiff < candidates[j].lenDiff
+	})
+	var distractors []string
+	for i := 0; i < n && i < len(candidates); i++ {
+		distractors = append(distractors, candidates[i].answer)
+	}
+	return distractors
+}
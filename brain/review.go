@@ -0,0 +1,72 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Answer describes how the user answered a study.
+type Answer struct {
+	// Typed is true if the user typed the phrase instead of using the buttons.
+	Typed bool
+	// Latency is the time the user took to answer; it's 0 if unknown.
+	Latency time.Duration
+}
+
+// Review is the record of a single graded study.
+type Review struct {
+	ChatID   int64
+	PhraseID int64
+	// Reverse is true if the phrase has been studied in reverse direction.
+	Reverse bool `json:",omitempty"`
+	// Cloze is the cloze index if a cloze phrase has been studied.
+	Cloze int `json:",omitempty"`
+	Time  time.Time
+	// Grade is the score the study has been graded with.
+	Grade int
+	// PrevInterval is the interval the phrase had before the study.
+	PrevInterval time.Duration
+	// Interval is the interval until the next study.
+	Interval time.Duration
+	Answer
+}
+
+// Append a review to the log and return its key.
+func addReview(tx *bolt.Tx, r Review) ([]byte, error) {
+	br := tx.Bucket(bucketReviews)
+	sequence, err := br.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	key := append(itob(r.ChatID), itob(int64(sequence))...)
+	return key, br.Put(key, buf)
+}
+
+// GetReviews returns all reviews of a chat ordered by time.
+func (store Bolt) GetReviews(chatID int64) ([]Review, error) {
+	var reviews []Review
+	err := store.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketReviews).Cursor()
+		prefix := itob(chatID)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var r Review
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			reviews = append(reviews, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return reviews, fmt.Errorf("failed to get reviews for chatID %d: %v", chatID, err)
+	}
+	return reviews, nil
+}
@@ -0,0 +1,160 @@
+package brain
+
+import (
+	"math"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Scheduler decides when a phrase needs to be studied next.
+type Scheduler interface {
+	// Next takes the current state of a phrase and the grade of the latest study.
+	// The grade is -1 if the user didn't know the phrase,
+	// 0 if the user was unsure and 1 if the user knew the phrase.
+	// Next returns the updated state and the time the phrase is due again.
+	Next(state ReviewState, grade int, now time.Time) (ReviewState, time.Time)
+}
+
+// Schedulers contains all available schedulers by name.
+var Schedulers = map[string]Scheduler{
+	"exponential": Exponential{},
+	"sm2":         SM2{},
+	"fsrs":        FSRS{},
+}
+
+// ReviewState is the scheduling state of a phrase.
+// It contains the fields of all schedulers
+// so switching the scheduler doesn't lose any history.
+type ReviewState struct {
+	// Score is the sum of all grades.
+	Score int
+	// Reviewed is the time of the latest study.
+	Reviewed time.Time
+	// Interval is the time between the latest study and the next one.
+	// While relearning a lapsed card it's the interval after the last learning step.
+	Interval time.Duration `json:",omitempty"`
+	// Step is the learning step the card is in, starting at 1.
+	// It's 0 if the card is new or scheduled by the Scheduler. See LearningSteps.
+	Step int `json:",omitempty"`
+	// Lapsed is true if the latest study has been graded as not known.
+	Lapsed bool `json:",omitempty"`
+	// Ease is the SM-2 easiness factor.
+	Ease float64 `json:",omitempty"`
+	// Repetitions is the number of SM-2 studies in a row without failing.
+	Repetitions int `json:",omitempty"`
+	// Stability is the FSRS stability in days.
+	Stability float64 `json:",omitempty"`
+	// Difficulty is the FSRS difficulty between 1 and 10.
+	Difficulty float64 `json:",omitempty"`
+}
+
+// Exponential doubles the time between studies for each point of the score.
+// The score is never considered lower than 0.
+type Exponential struct{}
+
+// Next implements Scheduler.
+func (Exponential) Next(state ReviewState, grade int, now time.Time) (ReviewState, time.Time) {
+	score := state.Score
+	if score < 0 {
+		score = 0
+	}
+	return state, now.Add((baseStudytime << uint(score)) * time.Hour)
+}
+
+const (
+	sm2InitialEase = 2.5
+	sm2MinEase     = 1.3
+)
+
+// SM2 implements the SuperMemo 2 algorithm.
+// See https://www.supermemo.com/en/archives1990-2015/english/ol/sm2
+type SM2 struct{}
+
+// Next implements Scheduler.
+func (SM2) Next(state ReviewState, grade int, now time.Time) (ReviewState, time.Time) {
+	// Map grade to SM-2 quality: 1, 3 or 5
+	q := float64(3 + 2*grade)
+	if state.Ease == 0 {
+		state.Ease = sm2InitialEase
+		// Continue with the interval of a previously used scheduler
+		if state.Interval >= 6*day {
+			state.Repetitions = 2
+		}
+	}
+	var interval time.Duration
+	if q < 3 {
+		state.Repetitions = 0
+		interval = day
+	} else {
+		switch state.Repetitions {
+		case 0:
+			interval = day
+		case 1:
+			interval = 6 * day
+		default:
+			interval = time.Duration(float64(state.Interval) * state.Ease)
+		}
+		if interval < day {
+			interval = day
+		}
+		state.Repetitions++
+	}
+	state.Ease += 0.1 - (5-q)*(0.08+(5-q)*0.02)
+	if state.Ease < sm2MinEase {
+		state.Ease = sm2MinEase
+	}
+	return state, now.Add(interval)
+}
+
+// Default FSRS parameters
+var fsrsWeights = [...]float64{
+	0.4, 0.6, 2.4, 5.8, 4.93, 0.94, 0.86, 0.01, 1.49,
+	0.14, 0.94, 2.18, 0.05, 0.34, 1.26, 0.29, 2.61,
+}
+
+// FSRS implements version 4 of the Free Spaced Repetition Scheduler
+// with the default parameters and a desired retention of 90%.
+// See https://github.com/open-spaced-repetition/fsrs4anki/wiki/The-Algorithm
+type FSRS struct{}
+
+// Next implements Scheduler.
+func (FSRS) Next(state ReviewState, grade int, now time.Time) (ReviewState, time.Time) {
+	w := fsrsWeights
+	// Map grade to FSRS rating: again (1), hard (2) or good (3)
+	g := float64(grade + 2)
+	if state.Stability == 0 && state.Interval > 0 {
+		// Continue with the interval of a previously used scheduler
+		state.Stability = float64(state.Interval) / float64(day)
+		state.Difficulty = w[4]
+	}
+	if state.Stability == 0 {
+		state.Stability = w[int(g)-1]
+		state.Difficulty = fsrsClamp(w[4] - (g-3)*w[5])
+	} else {
+		elapsed := float64(now.Sub(state.Reviewed)) / float64(day)
+		if state.Reviewed.IsZero() {
+			elapsed = float64(state.Interval) / float64(day)
+		}
+		r := 1 / (1 + elapsed/(9*state.Stability))
+		s := state.Stability
+		d := state.Difficulty
+		if g == 1 {
+			state.Stability = w[11] * math.Pow(d, -w[12]) * (math.Pow(s+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+		} else {
+			hardPenalty := 1.0
+			if g == 2 {
+				hardPenalty = w[15]
+			}
+			state.Stability = s * (1 + math.Exp(w[8])*(11-d)*math.Pow(s, -w[9])*(math.Exp(w[10]*(1-r))-1)*hardPenalty)
+		}
+		// Mean reversion towards the initial difficulty of a good rating
+		state.Difficulty = fsrsClamp(w[7]*w[4] + (1-w[7])*(d-w[6]*(g-3)))
+	}
+	// With a desired retention of 90% the interval equals the stability
+	return state, now.Add(time.Duration(state.Stability * float64(day)))
+}
+
+func fsrsClamp(d float64) float64 {
+	return math.Min(math.Max(d, 1), 10)
+}
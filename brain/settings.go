@@ -0,0 +1,139 @@
+package brain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Strictness describes how typed answers with small typos are graded.
+type Strictness int
+
+const (
+	// StrictnessNormal grades answers with small typos as almost known.
+	StrictnessNormal Strictness = iota
+	// StrictnessLenient grades answers with small typos as known.
+	StrictnessLenient
+	// StrictnessStrict grades answers with small typos as not known.
+	StrictnessStrict
+)
+
+// ErrInvalidSettings is returned when saving settings with values out of range.
+var ErrInvalidSettings = errors.New("invalid settings")
+
+// UserSettings are the preferences of a chat.
+// Chats that never changed their settings use DefaultSettings.
+type UserSettings struct {
+	// NewPerDay is the maximum number of new phrases to study per day.
+	// Days start at midnight in the Timezone.
+	NewPerDay int
+	// NotifyMinCount is the minimum number of due studies before the user is notified.
+	NotifyMinCount int
+	// Strictness is how typed answers are graded.
+	Strictness Strictness
+	// Direction is the direction phrases of new decks and of the default deck are studied in
+	// as long as no other direction is set for the deck.
+	Direction Direction
+	// QuietFrom and QuietTo are the hours of the day
+	// between which no notifications are sent.
+	// There are no quiet hours if both are the same.
+	QuietFrom int
+	QuietTo   int
+	// BacklogPerDay is the maximum number of overdue studies per day
+	// when catching up after being away. See SpreadBacklog.
+	BacklogPerDay int
+	// Timezone is the offset of the timezone of the user to UTC in hours.
+	// It decides when a day starts for counting new phrases.
+	Timezone float64
+}
+
+// DefaultSettings returns the settings of chats that never changed them.
+func DefaultSettings() UserSettings {
+	return UserSettings{
+		NewPerDay:      newPerDay,
+		NotifyMinCount: dueMinCount,
+		BacklogPerDay:  backlogPerDay,
+	}
+}
+
+func (s UserSettings) validate() error {
+	if s.NewPerDay < 1 || s.NotifyMinCount < 1 || s.BacklogPerDay < 1 ||
+		s.QuietFrom < 0 || s.QuietFrom > 23 || s.QuietTo < 0 || s.QuietTo > 23 ||
+		s.Timezone < -12 || s.Timezone > 14 {
+		return ErrInvalidSettings
+	}
+	if s.Strictness < StrictnessNormal || s.Strictness > StrictnessStrict {
+		return ErrInvalidSettings
+	}
+	if s.Direction < DirectionForward || s.Direction > DirectionBoth {
+		return ErrInvalidSettings
+	}
+	return nil
+}
+
+// QuietUntil returns the time until the quiet hours end.
+// It returns 0 if the given time is not within the quiet hours.
+// The time must be in the timezone of the user.
+func (s UserSettings) QuietUntil(t time.Time) time.Duration {
+	h := t.Hour()
+	quiet := false
+	if s.QuietFrom < s.QuietTo {
+		quiet = h >= s.QuietFrom && h < s.QuietTo
+	} else if s.QuietFrom > s.QuietTo {
+		quiet = h >= s.QuietFrom || h < s.QuietTo
+	}
+	if !quiet {
+		return 0
+	}
+	end := time.Date(t.Year(), t.Month(), t.Day(), s.QuietTo, 0, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end.Sub(t)
+}
+
+// GetUserSettings returns the settings of a chat.
+func (store Bolt) GetUserSettings(chatID int64) (UserSettings, error) {
+	var settings UserSettings
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		settings, err = getUserSettings(tx, chatID)
+		return err
+	})
+	if err != nil {
+		return settings, fmt.Errorf("failed to get settings for chatID %d: %v", chatID, err)
+	}
+	return settings, nil
+}
+
+func getUserSettings(tx *bolt.Tx, chatID int64) (UserSettings, error) {
+	settings := DefaultSettings()
+	v := tx.Bucket(bucketSettings).Get(itob(chatID))
+	if v == nil {
+		return settings, nil
+	}
+	err := json.Unmarshal(v, &settings)
+	return settings, err
+}
+
+// SetUserSettings updates the settings of a chat.
+// Returns ErrInvalidSettings if a value is out of range.
+func (store Bolt) SetUserSettings(chatID int64, settings UserSettings) error {
+	if err := settings.validate(); err != nil {
+		return err
+	}
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		buf, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketSettings).Put(itob(chatID), buf)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set settings for chatID %d: %v", chatID, err)
+	}
+	return nil
+}
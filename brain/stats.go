@@ -0,0 +1,207 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Phrases with at least this score are considered mature.
+const matureScore = 5
+
+// Stats summarizes the learning progress of a user.
+type Stats struct {
+	// Total is the number of all phrases.
+	Total int
+	// New is the number of phrases that have never been studied.
+	New int
+	// Learning is the number of studied phrases that are not mature yet.
+	Learning int
+	// Mature is the number of phrases with a high score.
+	Mature int
+	// ReviewsToday is the number of studies since the beginning of the day.
+	ReviewsToday int
+	// Reviews7 and Reviews30 are the numbers of studies in the last 7 and 30 days.
+	Reviews7  int
+	Reviews30 int
+	// Retention7 and Retention30 are the shares of studies in the last 7 and 30 days
+	// where the user didn't fail to remember the phrase.
+	// They are between 0 and 1 and 0 if there have been no studies.
+	Retention7  float64
+	Retention30 float64
+	// Streak is the number of days in a row the user studied,
+	// counting back from today or yesterday.
+	Streak int
+	// Forecast contains the number of studies due for today and the next six days.
+	// Overdue studies are included in today's count.
+	// Like when studying, phrases in the queue of new phrases,
+	// suspended phrases and phrases of other decks than the studied one are not included.
+	Forecast [7]int
+}
+
+// GetStats calculates the learning statistics of a chat.
+// The location of now is used to determine the beginning of a day.
+func (store Bolt) GetStats(chatID int64, now time.Time) (Stats, error) {
+	var phrases []Phrase
+	var studytimes []time.Time
+	var reviews []Review
+	err := store.db.View(func(tx *bolt.Tx) error {
+		prefix := itob(chatID)
+		c := tx.Bucket(bucketPhrases).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var p Phrase
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			phrases = append(phrases, p)
+		}
+		due, err := newDueCursor(tx, chatID)
+		if err != nil {
+			return err
+		}
+		studytimes = forecastStudytimes(due, now)
+		reviews, err = recentReviews(tx, chatID, now)
+		return err
+	})
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to get stats for chatID %d: %v", chatID, err)
+	}
+	return calcStats(phrases, studytimes, reviews, now), nil
+}
+
+// Get the study times of the studies in the forecast.
+// Studies are ordered by time so only the ones due before the end of the forecast are read.
+func forecastStudytimes(due studyCursor, now time.Time) []time.Time {
+	var studytimes []time.Time
+	end := startOfDay(now).AddDate(0, 0, len(Stats{}.Forecast)).Unix()
+	for k, t := due.first(); k != nil && t < end; k, t = due.next() {
+		studytimes = append(studytimes, time.Unix(t, 0))
+	}
+	return studytimes
+}
+
+// Get the reviews of a chat the stats are calculated from, newest first.
+// Reviews are logged in the order they happen,
+// so the log is read backwards until the reviews are older than 30 days
+// and don't continue the streak anymore.
+func recentReviews(tx *bolt.Tx, chatID int64, now time.Time) ([]Review, error) {
+	var reviews []Review
+	prefix := itob(chatID)
+	today := startOfDay(now)
+	// Day of the oldest review read so far.
+	// Studying today or yesterday continues the streak.
+	oldest := 0
+	c := tx.Bucket(bucketReviews).Cursor()
+	// No review has the highest sequence, so seeking ends up right after the reviews of the chat
+	k, v := c.Seek(append(itob(chatID), itob(-1)...))
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+		var r Review
+		if err := json.Unmarshal(v, &r); err != nil {
+			return nil, err
+		}
+		d := daysBetween(today, r.Time)
+		if now.Sub(r.Time) > 30*day && d < oldest-1 {
+			break
+		}
+		oldest = d
+		reviews = append(reviews, r)
+	}
+	return reviews, nil
+}
+
+func calcStats(phrases []Phrase, studytimes []time.Time, reviews []Review, now time.Time) Stats {
+	s := Stats{Total: len(phrases)}
+	for _, p := range phrases {
+		// A phrase is as mature as its best card
+		studied := !p.isNew()
+		score := 0
+		for _, state := range p.cardStates() {
+			if state.Score > score {
+				score = state.Score
+			}
+		}
+		switch {
+		case !studied:
+			s.New++
+		case score >= matureScore:
+			s.Mature++
+		default:
+			s.Learning++
+		}
+	}
+
+	today := startOfDay(now)
+	for _, t := range studytimes {
+		d := daysBetween(today, t)
+		if d < 0 {
+			d = 0
+		}
+		if d < len(s.Forecast) {
+			s.Forecast[d]++
+		}
+	}
+
+	known7, known30 := 0, 0
+	studyDays := map[int]bool{}
+	for _, r := range reviews {
+		d := daysBetween(today, r.Time)
+		studyDays[d] = true
+		if d == 0 {
+			s.ReviewsToday++
+		}
+		age := now.Sub(r.Time)
+		if age <= 30*day {
+			s.Reviews30++
+			if r.Grade >= 0 {
+				known30++
+			}
+		}
+		if age <= 7*day {
+			s.Reviews7++
+			if r.Grade >= 0 {
+				known7++
+			}
+		}
+	}
+	if s.Reviews7 > 0 {
+		s.Retention7 = float64(known7) / float64(s.Reviews7)
+	}
+	if s.Reviews30 > 0 {
+		s.Retention30 = float64(known30) / float64(s.Reviews30)
+	}
+
+	// Not having studied today yet doesn't break the streak
+	d := 0
+	if !studyDays[0] {
+		d = -1
+	}
+	for ; studyDays[d]; d-- {
+		s.Streak++
+	}
+
+	return s
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// Number of calendar days from the day start to the day of t.
+// Negative for days in the past.
+func daysBetween(start, t time.Time) int {
+	y, m, d := t.In(start.Location()).Date()
+	sy, sm, sd := start.Date()
+	// Compare in UTC to avoid issues with daylight saving time
+	a := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	b := time.Date(sy, sm, sd, 0, 0, 0, 0, time.UTC)
+	return int(a.Sub(b) / day)
+}
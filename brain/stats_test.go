@@ -0,0 +1,57 @@
+package brain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestStatsReviews(t *testing.T) {
+	store, cleanup := openTestBolt(t)
+	defer cleanup()
+	now := time.Date(2017, 6, 15, 12, 0, 0, 0, time.UTC)
+	const chatID, other = 1, 2
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		// An old review not continuing the streak
+		if _, err := addReview(tx, Review{ChatID: chatID, Time: now.AddDate(0, 0, -60)}); err != nil {
+			return err
+		}
+		// Studied every day for 40 days until yesterday
+		for d := 40; d > 0; d-- {
+			if _, err := addReview(tx, Review{ChatID: chatID, Time: now.AddDate(0, 0, -d), Grade: 1}); err != nil {
+				return err
+			}
+		}
+		// Reviews of other chats are logged in between
+		_, err := addReview(tx, Review{ChatID: other, Time: now})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reviews []Review
+	err = store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		reviews, err = recentReviews(tx, chatID, now)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 40 {
+		t.Errorf("expected the 40 reviews of the streak, got %d", len(reviews))
+	}
+
+	stats, err := store.GetStats(chatID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Streak != 40 || stats.Reviews30 != 30 || stats.Reviews7 != 7 || stats.ReviewsToday != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats, err := store.GetStats(other, now); err != nil || stats.ReviewsToday != 1 || stats.Streak != 1 {
+		t.Errorf("expected one review today for the other chat, got %+v: %v", stats, err)
+	}
+}
@@ -1,41 +1,167 @@
 package brain
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math/rand"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/boltdb/bolt"
 )
 
-// Store provides functions to interact with the underlying database.
-type Store struct {
-	db *bolt.DB
+// Store provides functions to interact with the stored data of all chats.
+// Bolt stores data in a file and Memory keeps it in memory only.
+type Store interface {
+	// Modes
+	GetMode(chatID int64) (Mode, error)
+	SetMode(chatID int64, mode Mode) error
+	SetModePhrase(chatID int64, mode Mode, phraseID int64) error
+	GetModePhrase(chatID int64) (int64, error)
+
+	// Phrases
+	AddPhrase(chatID int64, phrase, explanation string, alternatives ...string) (int64, error)
+	AddCloze(chatID int64, text, explanation string) (int64, error)
+	GetPhrase(chatID, phraseID int64) (Phrase, error)
+	UpdatePhrase(chatID, phraseID int64, phrase, explanation string, alternatives ...string) error
+	FindPhrase(chatID int64, fn func(Phrase) bool) (Phrase, error)
+	DeleteStudyPhrase(chatID int64) error
+	SetPhraseDirection(chatID, phraseID int64, d Direction) error
+	ImportPhrases(chatID int64, phrases []Phrase) ([]int64, error)
+
+	// Studies
+	GetStudy(chatID int64) (Study, error)
+	ScoreStudy(chatID int64, score int, answer Answer) (bool, error)
+	UndoStudy(chatID int64) (bool, error)
+	GetDistractors(chatID int64, study Study, n int) ([]string, error)
+	GetSuspended(chatID int64) ([]Leech, error)
+	UnsuspendPhrase(chatID, phraseID int64) error
+	ResetPhrase(chatID, phraseID int64) error
+	GetReviews(chatID int64) ([]Review, error)
+	GetStats(chatID int64, now time.Time) (Stats, error)
+	SpreadBacklog(chatID int64, now time.Time) (Backlog, error)
+
+	// Decks
+	GetDecks(chatID int64) ([]Deck, error)
+	GetDeck(chatID, deckID int64) (Deck, error)
+	AddDeck(chatID int64, name string) (int64, error)
+	RenameDeck(chatID, deckID int64, name string) error
+	DeleteDeck(chatID, deckID int64) error
+	SetDeckDirection(chatID, deckID int64, d Direction) error
+	GetDeckSettings(chatID int64) (DeckSettings, error)
+	SetDeckSettings(chatID int64, settings DeckSettings) error
+
+	// Settings
+	GetUserSettings(chatID int64) (UserSettings, error)
+	SetUserSettings(chatID int64, settings UserSettings) error
+
+	// Notifications
+	GetNotifyTime(chatID int64) (time.Duration, int, error)
+	EachActiveChat(fn func(int64)) error
+	SetActivity(chatID int64, t time.Time) error
+	SetRead(chatID int64, t time.Time) error
+	IsSubscribed(chatID int64) (bool, error)
+	Subscribe(chatID int64) error
+	Unsubscribe(chatID int64) error
+	Pause(chatID int64, t time.Time) error
+	PausedSince(chatID int64) (time.Time, error)
+	Resume(chatID int64, t time.Time) (time.Duration, error)
+
+	// Administration
+	BackupTo(w http.ResponseWriter)
+	StudyNow() error
+	DeleteChat(chatID int64) error
+	GetChatIDs() ([]int64, error)
+	Export(chatID int64, format Format, w io.Writer) error
+	DeletePhrases(fn func(int64, Phrase) bool) (int, error)
+	Close() error
+}
+
+// Options configure how a Store schedules studies.
+type Options struct {
+	// Scheduler calculates the study times.
+	Scheduler Scheduler
+	// LeechThreshold is the number of lapses after which a phrase is suspended.
+	LeechThreshold int
+	// LearningSteps are the delays between studies of new and lapsed cards
+	// before they are scheduled by the Scheduler again.
+	LearningSteps []time.Duration
+}
+
+// UseScheduler is an option to set the Scheduler used to calculate study times.
+// Exponential is used by default.
+func UseScheduler(s Scheduler) func(*Options) {
+	return func(o *Options) {
+		o.Scheduler = s
+	}
+}
+
+// LeechThreshold is an option to set the number of lapses after which a phrase is suspended.
+// A lapse is a study graded as not known.
+// Phrases are never suspended if the threshold is 0.
+func LeechThreshold(n int) func(*Options) {
+	return func(o *Options) {
+		o.LeechThreshold = n
+	}
+}
+
+// LearningSteps is an option to study new and forgotten cards again within the same session.
+// A known card moves to the next step and after the last step
+// it's scheduled by the Scheduler.
+// An unsure card repeats its step and a card not known starts over with the first step.
+// Without steps, which is the default, all cards are scheduled by the Scheduler right away.
+func LearningSteps(steps ...time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.LearningSteps = steps
+	}
+}
+
+func newOptions(options []func(*Options)) Options {
+	o := Options{Scheduler: Exponential{}, LeechThreshold: defaultLeechThreshold}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// Bolt is a Store saving all data in a BoltDB file.
+type Bolt struct {
+	db   *bolt.DB
+	opts Options
 }
 
-// New returns a new Store with a database already setup.
-func New(dbFile string) (Store, error) {
+var _ Store = (*Bolt)(nil)
+
+// New returns a new Bolt store with a database already setup.
+// The options UseScheduler, LeechThreshold and LearningSteps can be used.
+// Existing databases might need to be updated with Migrate before they can be used.
+func New(dbFile string, options ...func(*Options)) (*Bolt, error) {
 	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 1 * time.Second})
-	store := Store{db}
+	store := &Bolt{db: db, opts: newOptions(options)}
 	if err != nil {
 		return store, fmt.Errorf("failed to open database: %v", err)
 	}
-	var buckets = [][]byte{
-		bucketModes,
-		bucketPhrases,
-		bucketStudytimes,
-		bucketReads,
-		bucketActivities,
-		bucketSubscriptions,
-	}
 	err = db.Update(func(tx *bolt.Tx) error {
-		for _, bucket := range buckets {
-			_, err = tx.CreateBucketIfNotExists(bucket)
-			if err != nil {
-				return fmt.Errorf("failed to create bucket '%s': %v", bucket, err)
+		// New databases don't need migrations
+		if tx.Bucket(bucketModes) == nil {
+			if _, err := tx.CreateBucket(bucketMeta); err != nil {
+				return fmt.Errorf("failed to create bucket '%s': %v", bucketMeta, err)
 			}
+			if err := putVersion(tx, latestVersion()); err != nil {
+				return err
+			}
+		}
+		if err := createBuckets(tx); err != nil {
+			return err
+		}
+		version, err := getVersion(tx)
+		if err != nil {
+			return err
+		}
+		if version > latestVersion() {
+			return fmt.Errorf("version %d: %v", version, ErrSchemaTooNew)
 		}
 		return nil
 	})
@@ -48,8 +174,55 @@ func New(dbFile string) (Store, error) {
 	return store, err
 }
 
+// Open returns a Bolt store of an existing database.
+// Unlike New, it doesn't create the file or any buckets.
+// Returns an error if the file doesn't exist.
+// Use it to inspect a database without changing it, like for a dry run of Migrate.
+// The options UseScheduler, LeechThreshold and LearningSteps can be used.
+func Open(dbFile string, options ...func(*Options)) (*Bolt, error) {
+	if _, err := os.Stat(dbFile); err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return &Bolt{db: db, opts: newOptions(options)}, nil
+}
+
+// Buckets of all records
+var buckets = [][]byte{
+	bucketModes,
+	bucketPhrases,
+	bucketStudytimes,
+	bucketReads,
+	bucketActivities,
+	bucketSubscriptions,
+	bucketReviews,
+	bucketDecks,
+	bucketDeckSettings,
+	bucketUndos,
+	bucketMeta,
+	bucketDue,
+	bucketSettings,
+	bucketPauses,
+	bucketNewQueue,
+	bucketNewCounts,
+	bucketDeckDue,
+	bucketBacklogs,
+}
+
+func createBuckets(tx *bolt.Tx) error {
+	for _, bucket := range buckets {
+		if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+			return fmt.Errorf("failed to create bucket '%s': %v", bucket, err)
+		}
+	}
+	return nil
+}
+
 // Close the underlying database connection.
-func (store *Store) Close() error {
+func (store *Bolt) Close() error {
 	if err := store.db.Close(); err != nil {
 		return fmt.Errorf("failed to close database: %v", err)
 	}
@@ -57,7 +230,7 @@ func (store *Store) Close() error {
 }
 
 // SetActivity sets the last time a message was sent to a user.
-func (store Store) SetActivity(chatID int64, t time.Time) error {
+func (store Bolt) SetActivity(chatID int64, t time.Time) error {
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		return tx.Bucket(bucketActivities).Put(itob(chatID), itob(t.Unix()))
 	})
@@ -68,7 +241,7 @@ func (store Store) SetActivity(chatID int64, t time.Time) error {
 }
 
 // SetRead sets the last time the user read a message.
-func (store Store) SetRead(chatID int64, t time.Time) error {
+func (store Bolt) SetRead(chatID int64, t time.Time) error {
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		return tx.Bucket(bucketReads).Put(itob(chatID), itob(t.Unix()))
 	})
@@ -78,12 +251,19 @@ func (store Store) SetRead(chatID int64, t time.Time) error {
 	return nil
 }
 
+// Integers in keys and values are stored as 8 bytes in big-endian order.
+// This way keys of IDs and times sort numerically
+// and cursors iterate them in order.
+// IDs and times are never negative.
 func itob(v int64) []byte {
 	b := make([]byte, 8)
-	binary.PutVarint(b, int64(v))
+	binary.BigEndian.PutUint64(b, uint64(v))
 	return b
 }
 
 func btoi(b []byte) (int64, error) {
-	return binary.ReadVarint(bytes.NewBuffer(b))
+	if len(b) != 8 {
+		return 0, fmt.Errorf("invalid integer of %d bytes", len(b))
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
 }
@@ -0,0 +1,115 @@
+package storetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jorinvo/studybot/brain"
+)
+
+// Number of phrases of the chat used in benchmarks
+const benchPhrases = 2000
+
+// Add many phrases to a store.
+// None of them are ready to study yet, like for most users most of the time.
+func setupBench(b *testing.B, newStore func() brain.Store) brain.Store {
+	store := newStore()
+	for i := 0; i < benchPhrases; i++ {
+		if _, err := store.AddPhrase(chatID, fmt.Sprintf("phrase %d", i), fmt.Sprintf("explanation %d", i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	return store
+}
+
+// Add many overdue phrases to a store which are not studied
+// since they are suspended or in another deck than the studied one.
+// A few phrases of the studied deck are ready tomorrow.
+func setupSkippedBench(b *testing.B, newStore func() brain.Store) brain.Store {
+	store := newStore()
+	overdue := func(i int, suspended bool) brain.Phrase {
+		return brain.Phrase{
+			Phrase:      fmt.Sprintf("phrase %d", i),
+			Explanation: fmt.Sprintf("explanation %d", i),
+			ReviewState: brain.ReviewState{Score: 1, Reviewed: time.Now().AddDate(0, 0, -10), Interval: 24 * time.Hour},
+			Suspended:   suspended,
+		}
+	}
+	var other, suspended, ready []brain.Phrase
+	for i := 0; i < benchPhrases/2; i++ {
+		other = append(other, overdue(i, false))
+		suspended = append(suspended, overdue(benchPhrases+i, true))
+	}
+	for i := 0; i < 10; i++ {
+		p := overdue(2*benchPhrases+i, false)
+		p.Reviewed = time.Now()
+		ready = append(ready, p)
+	}
+	if _, err := store.ImportPhrases(chatID, other); err != nil {
+		b.Fatal(err)
+	}
+	deckID, err := store.AddDeck(chatID, "studied")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := store.SetDeckSettings(chatID, brain.DeckSettings{Current: deckID}); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := store.ImportPhrases(chatID, append(suspended, ready...)); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	return store
+}
+
+// BenchmarkGetStudy measures finding the next study of a chat with many phrases.
+func BenchmarkGetStudy(b *testing.B, newStore func() brain.Store) {
+	store := setupBench(b, newStore)
+	defer store.Close()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.GetStudy(chatID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetNotifyTime measures calculating the next notification of a chat with many phrases.
+func BenchmarkGetNotifyTime(b *testing.B, newStore func() brain.Store) {
+	store := setupBench(b, newStore)
+	defer store.Close()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := store.GetNotifyTime(chatID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetStudySkipped measures finding the next study of a chat
+// with many overdue phrases that are suspended or in other decks.
+func BenchmarkGetStudySkipped(b *testing.B, newStore func() brain.Store) {
+	store := setupSkippedBench(b, newStore)
+	defer store.Close()
+	for i := 0; i < b.N; i++ {
+		study, err := store.GetStudy(chatID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if study.Total != 0 || study.Next <= 0 {
+			b.Fatalf("expected no studies now, got %+v", study)
+		}
+	}
+}
+
+// BenchmarkGetNotifyTimeSkipped measures calculating the next notification of a chat
+// with many overdue phrases that are suspended or in other decks.
+func BenchmarkGetNotifyTimeSkipped(b *testing.B, newStore func() brain.Store) {
+	store := setupSkippedBench(b, newStore)
+	defer store.Close()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := store.GetNotifyTime(chatID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
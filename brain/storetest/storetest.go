@@ -0,0 +1,933 @@
+// Package storetest provides a conformance suite for implementations of brain.Store.
+// Every implementation has to pass it to be usable by the bot.
+package storetest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorinvo/studybot/brain"
+)
+
+// Run runs all conformance tests.
+// newStore must return a new empty store for each call.
+func Run(t *testing.T, newStore func() brain.Store) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, brain.Store)
+	}{
+		{"Mode", testMode},
+		{"Phrases", testPhrases},
+		{"Study", testStudy},
+		{"Undo", testUndo},
+		{"Leech", testLeech},
+		{"Directions", testDirections},
+		{"Cloze", testCloze},
+		{"Decks", testDecks},
+		{"Distractors", testDistractors},
+		{"Notify", testNotify},
+		{"Subscriptions", testSubscriptions},
+		{"Pause", testPause},
+		{"Backlog", testBacklog},
+		{"NewQueue", testNewQueue},
+		{"Settings", testSettings},
+		{"Import", testImport},
+		{"Admin", testAdmin},
+		{"DeleteChat", testDeleteChat},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newStore()
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			test.fn(t, store)
+		})
+	}
+}
+
+// RunOptions runs the conformance tests of the options a store is created with.
+// newStore must return a new empty store using the given options for each call.
+func RunOptions(t *testing.T, newStore func(options ...func(*brain.Options)) brain.Store) {
+	tests := []struct {
+		name    string
+		options []func(*brain.Options)
+		fn      func(*testing.T, brain.Store)
+	}{
+		{"LearningSteps", []func(*brain.Options){brain.LearningSteps(time.Minute, 10*time.Minute)}, testLearningSteps},
+		{"LeechDirections", []func(*brain.Options){brain.LeechThreshold(1)}, testLeechDirections},
+		{"LeechClozes", []func(*brain.Options){brain.LeechThreshold(1)}, testLeechClozes},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newStore(test.options...)
+			defer func() {
+				if err := store.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			test.fn(t, store)
+		})
+	}
+}
+
+const chatID int64 = 1
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addPhrase(t *testing.T, store brain.Store, phrase, explanation string) int64 {
+	t.Helper()
+	id, err := store.AddPhrase(chatID, phrase, explanation)
+	check(t, err)
+	return id
+}
+
+// Make all studies ready and return the current one.
+func studyNow(t *testing.T, store brain.Store) brain.Study {
+	t.Helper()
+	check(t, store.StudyNow())
+	study, err := store.GetStudy(chatID)
+	check(t, err)
+	return study
+}
+
+func testMode(t *testing.T, store brain.Store) {
+	mode, err := store.GetMode(chatID)
+	check(t, err)
+	if mode != brain.ModeGetStarted {
+		t.Errorf("expected mode of new chat to be %d, got %d", brain.ModeGetStarted, mode)
+	}
+	check(t, store.SetMode(chatID, brain.ModeStudy))
+	mode, err = store.GetMode(chatID)
+	check(t, err)
+	if mode != brain.ModeStudy {
+		t.Errorf("expected mode %d, got %d", brain.ModeStudy, mode)
+	}
+	check(t, store.SetModePhrase(chatID, brain.ModeEditLeech, 42))
+	mode, err = store.GetMode(chatID)
+	check(t, err)
+	phraseID, err := store.GetModePhrase(chatID)
+	check(t, err)
+	if mode != brain.ModeEditLeech || phraseID != 42 {
+		t.Errorf("expected mode %d with phrase 42, got %d with phrase %d", brain.ModeEditLeech, mode, phraseID)
+	}
+	// Setting only the mode forgets the phrase
+	check(t, store.SetMode(chatID, brain.ModeStudy))
+	if phraseID, err = store.GetModePhrase(chatID); err != nil || phraseID != 0 {
+		t.Errorf("expected no phrase, got %d: %v", phraseID, err)
+	}
+	ids, err := store.GetChatIDs()
+	check(t, err)
+	if len(ids) != 1 || ids[0] != chatID {
+		t.Errorf("expected chat IDs [%d], got %v", chatID, ids)
+	}
+}
+
+func testPhrases(t *testing.T, store brain.Store) {
+	id, err := store.AddPhrase(chatID, "hola", "hello", "buenas")
+	check(t, err)
+	p, err := store.GetPhrase(chatID, id)
+	check(t, err)
+	if p.Phrase != "hola" || p.Explanation != "hello" || len(p.Alternatives) != 1 {
+		t.Errorf("unexpected phrase %+v", p)
+	}
+	if _, err := store.GetPhrase(chatID+1, id); err != brain.ErrPhraseNotFound {
+		t.Errorf("expected ErrPhraseNotFound for other chat, got %v", err)
+	}
+	check(t, store.UpdatePhrase(chatID, id, "hola", "hi"))
+	found, err := store.FindPhrase(chatID, func(p brain.Phrase) bool { return p.Explanation == "hi" })
+	check(t, err)
+	if found.Phrase != "hola" {
+		t.Errorf("expected to find updated phrase, got %+v", found)
+	}
+	if err := store.UpdatePhrase(chatID, id+100, "x", "y"); err != brain.ErrPhraseNotFound {
+		t.Errorf("expected ErrPhraseNotFound, got %v", err)
+	}
+
+	// New phrases are not ready right away
+	study, err := store.GetStudy(chatID)
+	check(t, err)
+	if study.Total != 0 || study.Next <= 0 {
+		t.Errorf("expected no study ready but a next study, got %+v", study)
+	}
+	if studyNow(t, store).PhraseID != id {
+		t.Errorf("expected phrase %d to be studied", id)
+	}
+	check(t, store.DeleteStudyPhrase(chatID))
+	if _, err := store.GetPhrase(chatID, id); err != brain.ErrPhraseNotFound {
+		t.Errorf("expected deleted phrase to be gone, got %v", err)
+	}
+	if study := studyNow(t, store); study.Total != 0 || study.Next != 0 {
+		t.Errorf("expected no studies after deleting the only phrase, got %+v", study)
+	}
+}
+
+func testStudy(t *testing.T, store brain.Store) {
+	addPhrase(t, store, "hola", "hello")
+	addPhrase(t, store, "adios", "bye")
+	study := studyNow(t, store)
+	if study.Total != 2 {
+		t.Errorf("expected 2 studies, got %d", study.Total)
+	}
+	suspended, err := store.ScoreStudy(chatID, 1, brain.Answer{Typed: true})
+	check(t, err)
+	if suspended {
+		t.Error("expected phrase not to be suspended")
+	}
+	next, err := store.GetStudy(chatID)
+	check(t, err)
+	if next.Total != 1 || next.PhraseID == study.PhraseID {
+		t.Errorf("expected the other study to be next, got %+v", next)
+	}
+	reviews, err := store.GetReviews(chatID)
+	check(t, err)
+	if len(reviews) != 1 || reviews[0].PhraseID != study.PhraseID || reviews[0].Grade != 1 || !reviews[0].Typed {
+		t.Errorf("unexpected reviews %+v", reviews)
+	}
+	stats, err := store.GetStats(chatID, time.Now())
+	check(t, err)
+	if stats.Total != 2 || stats.New != 1 || stats.ReviewsToday != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	p, err := store.GetPhrase(chatID, study.PhraseID)
+	check(t, err)
+	if p.Score != 1 {
+		t.Errorf("expected score 1, got %d", p.Score)
+	}
+}
+
+func testUndo(t *testing.T, store brain.Store) {
+	undone, err := store.UndoStudy(chatID)
+	check(t, err)
+	if undone {
+		t.Error("expected nothing to undo")
+	}
+	addPhrase(t, store, "hola", "hello")
+	study := studyNow(t, store)
+	_, err = store.ScoreStudy(chatID, -1, brain.Answer{})
+	check(t, err)
+	undone, err = store.UndoStudy(chatID)
+	check(t, err)
+	if !undone {
+		t.Error("expected study to be undone")
+	}
+	again, err := store.GetStudy(chatID)
+	check(t, err)
+	if again.PhraseID != study.PhraseID || again.Total != 1 {
+		t.Errorf("expected the same study again, got %+v", again)
+	}
+	p, err := store.GetPhrase(chatID, study.PhraseID)
+	check(t, err)
+	if p.Score != 0 || p.Lapses != 0 {
+		t.Errorf("expected phrase to be restored, got %+v", p)
+	}
+	reviews, err := store.GetReviews(chatID)
+	check(t, err)
+	if len(reviews) != 0 {
+		t.Errorf("expected review to be removed, got %+v", reviews)
+	}
+	if undone, _ = store.UndoStudy(chatID); undone {
+		t.Error("expected only the latest study to be undoable")
+	}
+
+	// Changing the phrase after the study drops the snapshot
+	changes := []struct {
+		name string
+		fn   func() error
+	}{
+		{"edit", func() error { return store.UpdatePhrase(chatID, study.PhraseID, "hola!", "hello") }},
+		{"reset", func() error { return store.ResetPhrase(chatID, study.PhraseID) }},
+		{"direction", func() error { return store.SetPhraseDirection(chatID, study.PhraseID, brain.DirectionBoth) }},
+	}
+	for _, change := range changes {
+		studyNow(t, store)
+		_, err = store.ScoreStudy(chatID, 1, brain.Answer{})
+		check(t, err)
+		check(t, change.fn())
+		if undone, _ = store.UndoStudy(chatID); undone {
+			t.Errorf("expected no undo after %s", change.name)
+		}
+	}
+	p, err = store.GetPhrase(chatID, study.PhraseID)
+	check(t, err)
+	if p.Phrase != "hola!" || p.Direction != brain.DirectionBoth {
+		t.Errorf("expected changes to be kept, got %+v", p)
+	}
+}
+
+func testLeech(t *testing.T, store brain.Store) {
+	id := addPhrase(t, store, "hola", "hello")
+	suspended := false
+	for i := 0; i < 100 && !suspended; i++ {
+		studyNow(t, store)
+		var err error
+		suspended, err = store.ScoreStudy(chatID, -1, brain.Answer{})
+		check(t, err)
+	}
+	if !suspended {
+		t.Fatal("expected phrase to be suspended eventually")
+	}
+	if study := studyNow(t, store); study.Total != 0 {
+		t.Errorf("expected suspended phrase not to be studied, got %+v", study)
+	}
+	stats, err := store.GetStats(chatID, time.Now())
+	check(t, err)
+	if stats.Forecast != [7]int{} {
+		t.Errorf("expected suspended phrase not to be forecast, got %v", stats.Forecast)
+	}
+	leeches, err := store.GetSuspended(chatID)
+	check(t, err)
+	if len(leeches) != 1 || leeches[0].PhraseID != id {
+		t.Errorf("unexpected suspended phrases %+v", leeches)
+	}
+	check(t, store.UnsuspendPhrase(chatID, id))
+	if study := studyNow(t, store); study.PhraseID != id {
+		t.Errorf("expected unsuspended phrase to be studied, got %+v", study)
+	}
+	check(t, store.ResetPhrase(chatID, id))
+	p, err := store.GetPhrase(chatID, id)
+	check(t, err)
+	if p.Score != 0 || p.Lapses != 0 || p.Suspended {
+		t.Errorf("expected phrase to be reset, got %+v", p)
+	}
+}
+
+func testDirections(t *testing.T, store brain.Store) {
+	id := addPhrase(t, store, "hola", "hello")
+	check(t, store.SetPhraseDirection(chatID, id, brain.DirectionBoth))
+	study := studyNow(t, store)
+	if study.Total != 2 {
+		t.Errorf("expected studies in both directions, got %+v", study)
+	}
+	check(t, store.SetPhraseDirection(chatID, id, brain.DirectionReverse))
+	study = studyNow(t, store)
+	if study.Total != 1 || !study.Reverse || study.Phrase != "hello" || study.Explanation != "hola" {
+		t.Errorf("expected reverse study, got %+v", study)
+	}
+	if err := store.SetPhraseDirection(chatID, id+100, brain.DirectionBoth); err != brain.ErrPhraseNotFound {
+		t.Errorf("expected ErrPhraseNotFound, got %v", err)
+	}
+}
+
+func testCloze(t *testing.T, store brain.Store) {
+	if _, err := store.AddCloze(chatID, "no gaps", ""); err == nil {
+		t.Error("expected error for text without cloze")
+	}
+	id, err := store.AddCloze(chatID, "{{c1::yo}} {{c2::tengo}} un gato", "")
+	check(t, err)
+	study := studyNow(t, store)
+	if study.Total != 2 || !study.Cloze || study.PhraseID != id {
+		t.Errorf("expected two cloze studies, got %+v", study)
+	}
+	if err := store.SetPhraseDirection(chatID, id, brain.DirectionBoth); err != brain.ErrClozeDirection {
+		t.Errorf("expected ErrClozeDirection, got %v", err)
+	}
+	check(t, store.UpdatePhrase(chatID, id, "{{c1::yo}} tengo un gato", ""))
+	if study := studyNow(t, store); study.Total != 1 {
+		t.Errorf("expected one cloze study after removing a gap, got %+v", study)
+	}
+}
+
+func testDecks(t *testing.T, store brain.Store) {
+	decks, err := store.GetDecks(chatID)
+	check(t, err)
+	if len(decks) != 1 || decks[0].ID != brain.DefaultDeck {
+		t.Errorf("expected only the default deck, got %+v", decks)
+	}
+	deckID, err := store.AddDeck(chatID, "verbs")
+	check(t, err)
+	if _, err := store.AddDeck(chatID, "verbs"); err != brain.ErrDeckExists {
+		t.Errorf("expected ErrDeckExists, got %v", err)
+	}
+	check(t, store.RenameDeck(chatID, deckID, "nouns"))
+	deck, err := store.GetDeck(chatID, deckID)
+	check(t, err)
+	if deck.Name != "nouns" {
+		t.Errorf("expected renamed deck, got %+v", deck)
+	}
+	if _, err := store.GetDeck(chatID, deckID+100); err != brain.ErrDeckNotFound {
+		t.Errorf("expected ErrDeckNotFound, got %v", err)
+	}
+	check(t, store.SetDeckDirection(chatID, deckID, brain.DirectionReverse))
+
+	addPhrase(t, store, "hola", "hello")
+	check(t, store.SetDeckSettings(chatID, brain.DeckSettings{Current: deckID}))
+	id := addPhrase(t, store, "gato", "cat")
+	p, err := store.GetPhrase(chatID, id)
+	check(t, err)
+	if p.Deck != deckID || p.Direction != brain.DirectionReverse {
+		t.Errorf("expected phrase in deck %d with reverse direction, got %+v", deckID, p)
+	}
+	if study := studyNow(t, store); study.Total != 1 || study.PhraseID != id {
+		t.Errorf("expected only phrases of the current deck to be studied, got %+v", study)
+	}
+	_, err = store.ScoreStudy(chatID, 1, brain.Answer{})
+	check(t, err)
+	stats, err := store.GetStats(chatID, time.Now())
+	check(t, err)
+	if stats.Forecast == [7]int{} {
+		t.Errorf("expected studied phrase to be forecast, got %+v", stats)
+	}
+	check(t, store.SetDeckSettings(chatID, brain.DeckSettings{Current: brain.DefaultDeck}))
+	stats, err = store.GetStats(chatID, time.Now())
+	check(t, err)
+	if stats.Total != 2 || stats.Forecast != [7]int{} {
+		t.Errorf("expected only phrases of the current deck to be forecast, got %+v", stats)
+	}
+
+	if err := store.DeleteDeck(chatID, brain.DefaultDeck); err != brain.ErrDeleteDefaultDeck {
+		t.Errorf("expected ErrDeleteDefaultDeck, got %v", err)
+	}
+	check(t, store.DeleteDeck(chatID, deckID))
+	if _, err := store.GetPhrase(chatID, id); err != brain.ErrPhraseNotFound {
+		t.Errorf("expected phrases of deleted deck to be gone, got %v", err)
+	}
+	settings, err := store.GetDeckSettings(chatID)
+	check(t, err)
+	if settings.Current != brain.DefaultDeck {
+		t.Errorf("expected default deck to be current, got %+v", settings)
+	}
+}
+
+func testDistractors(t *testing.T, store brain.Store) {
+	for _, p := range []string{"hola", "adios", "gato", "perro"} {
+		addPhrase(t, store, p, "explanation of "+p)
+	}
+	study := studyNow(t, store)
+	distractors, err := store.GetDistractors(chatID, study, 3)
+	check(t, err)
+	if len(distractors) != 3 {
+		t.Fatalf("expected 3 distractors, got %v", distractors)
+	}
+	for _, d := range distractors {
+		if d == study.Phrase {
+			t.Errorf("expected distractors not to contain the answer, got %v", distractors)
+		}
+	}
+}
+
+func testNotify(t *testing.T, store brain.Store) {
+	_, count, err := store.GetNotifyTime(chatID)
+	check(t, err)
+	if count != 0 {
+		t.Errorf("expected no studies, got %d", count)
+	}
+	addPhrase(t, store, "hola", "hello")
+	check(t, store.StudyNow())
+	_, count, err = store.GetNotifyTime(chatID)
+	check(t, err)
+	if count != 1 {
+		t.Errorf("expected 1 study, got %d", count)
+	}
+
+	var active []int64
+	check(t, store.SetActivity(chatID, time.Now().Add(-time.Hour)))
+	check(t, store.SetRead(chatID, time.Now()))
+	check(t, store.EachActiveChat(func(id int64) { active = append(active, id) }))
+	if len(active) != 1 || active[0] != chatID {
+		t.Errorf("expected chat to be active, got %v", active)
+	}
+	active = nil
+	check(t, store.SetActivity(chatID, time.Now().Add(time.Hour)))
+	check(t, store.EachActiveChat(func(id int64) { active = append(active, id) }))
+	if len(active) != 0 {
+		t.Errorf("expected no active chats, got %v", active)
+	}
+}
+
+func testSubscriptions(t *testing.T, store brain.Store) {
+	isSubscribed, err := store.IsSubscribed(chatID)
+	check(t, err)
+	if isSubscribed {
+		t.Error("expected new chat not to be subscribed")
+	}
+	check(t, store.Subscribe(chatID))
+	if isSubscribed, _ = store.IsSubscribed(chatID); !isSubscribed {
+		t.Error("expected chat to be subscribed")
+	}
+	check(t, store.Unsubscribe(chatID))
+	if isSubscribed, _ = store.IsSubscribed(chatID); isSubscribed {
+		t.Error("expected chat to be unsubscribed")
+	}
+}
+
+func testPause(t *testing.T, store brain.Store) {
+	addPhrase(t, store, "hola", "hello")
+	check(t, store.StudyNow())
+	since, err := store.PausedSince(chatID)
+	check(t, err)
+	if !since.IsZero() {
+		t.Errorf("expected chat not to be paused, got %s", since)
+	}
+	if paused, err := store.Resume(chatID, time.Now()); err != nil || paused != 0 {
+		t.Errorf("expected resuming without pause to do nothing, got %s: %v", paused, err)
+	}
+
+	// Pauses are stored in seconds
+	start := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	check(t, store.Pause(chatID, start))
+	// Pausing again keeps the start
+	check(t, store.Pause(chatID, time.Now()))
+	since, err = store.PausedSince(chatID)
+	check(t, err)
+	if since.Unix() != start.Unix() {
+		t.Errorf("expected pause since %s, got %s", start, since)
+	}
+	if _, count, err := store.GetNotifyTime(chatID); err != nil || count != 0 {
+		t.Errorf("expected no notification while paused, got %d: %v", count, err)
+	}
+
+	paused, err := store.Resume(chatID, start.Add(72*time.Hour))
+	check(t, err)
+	if paused != 72*time.Hour {
+		t.Errorf("expected pause of 72h, got %s", paused)
+	}
+	study, err := store.GetStudy(chatID)
+	check(t, err)
+	if study.Total != 0 || study.Next < 71*time.Hour || study.Next > 72*time.Hour {
+		t.Errorf("expected study to be moved by the pause, got %+v", study)
+	}
+	if since, err := store.PausedSince(chatID); err != nil || !since.IsZero() {
+		t.Errorf("expected chat not to be paused anymore, got %s: %v", since, err)
+	}
+}
+
+func testBacklog(t *testing.T, store brain.Store) {
+	settings := brain.DefaultSettings()
+	settings.BacklogPerDay = 2
+	check(t, store.SetUserSettings(chatID, settings))
+	now := time.Now()
+	// Overdue phrases with the part of their interval they are overdue
+	overdue := func(phrase string, interval, late time.Duration) brain.Phrase {
+		return brain.Phrase{Phrase: phrase, Explanation: phrase, ReviewState: brain.ReviewState{
+			Score:    1,
+			Reviewed: now.Add(-interval - late),
+			Interval: interval,
+		}}
+	}
+	_, err := store.ImportPhrases(chatID, []brain.Phrase{
+		overdue("1", 24*time.Hour, 24*time.Hour),
+		overdue("0.1", 240*time.Hour, 24*time.Hour),
+		overdue("12", 2*time.Hour, 24*time.Hour),
+		overdue("0.25", 48*time.Hour, 12*time.Hour),
+		overdue("0.04", 24*time.Hour, time.Hour),
+	})
+	check(t, err)
+
+	backlog, err := store.SpreadBacklog(chatID, now)
+	check(t, err)
+	if backlog != (brain.Backlog{Overdue: 5, Today: 2, Days: 2}) {
+		t.Errorf("unexpected backlog %+v", backlog)
+	}
+	study, err := store.GetStudy(chatID)
+	check(t, err)
+	if study.Total != 2 || (study.Phrase != "1" && study.Phrase != "12") {
+		t.Errorf("expected the most overdue studies to stay due, got %+v", study)
+	}
+	// The backlog is only spread once a day
+	backlog, err = store.SpreadBacklog(chatID, now)
+	check(t, err)
+	if backlog != (brain.Backlog{}) {
+		t.Errorf("expected nothing to be spread again today, got %+v", backlog)
+	}
+	backlog, err = store.SpreadBacklog(chatID, now.Add(24*time.Hour+time.Minute))
+	check(t, err)
+	if backlog != (brain.Backlog{Overdue: 4, Today: 2, Days: 1}) {
+		t.Errorf("expected the studies of the next day to be due, got %+v", backlog)
+	}
+}
+
+func testNewQueue(t *testing.T, store brain.Store) {
+	settings := brain.DefaultSettings()
+	settings.NewPerDay = 2
+	settings.Timezone = -5
+	check(t, store.SetUserSettings(chatID, settings))
+	first := addPhrase(t, store, "hola", "hello")
+	second := addPhrase(t, store, "adios", "bye")
+	addPhrase(t, store, "gracias", "thanks")
+
+	// Only the first phrases of the queue are studied
+	study := studyNow(t, store)
+	if study.Total != 2 || study.PhraseID != first {
+		t.Errorf("expected 2 studies starting with phrase %d, got %+v", first, study)
+	}
+	_, count, err := store.GetNotifyTime(chatID)
+	check(t, err)
+	if count != 2 {
+		t.Errorf("expected 2 studies to notify about, got %d", count)
+	}
+	_, err = store.ScoreStudy(chatID, 1, brain.Answer{})
+	check(t, err)
+	// Studied phrases don't count again
+	study, err = store.GetStudy(chatID)
+	check(t, err)
+	if study.Total != 1 || study.PhraseID != second {
+		t.Errorf("expected phrase %d to be the last new study today, got %+v", second, study)
+	}
+	_, err = store.ScoreStudy(chatID, 1, brain.Answer{})
+	check(t, err)
+	study, err = store.GetStudy(chatID)
+	check(t, err)
+	if study.Total != 0 || study.Next <= 0 || study.Next > 24*time.Hour {
+		t.Errorf("expected the next new phrase tomorrow, got %+v", study)
+	}
+	stats, err := store.GetStats(chatID, time.Now())
+	check(t, err)
+	if stats.New != 1 || stats.Forecast[0]+stats.Forecast[1] != 2 {
+		t.Errorf("expected the queued phrase not to be forecast, got %+v", stats)
+	}
+
+	// Undoing puts the phrase back to the queue
+	undone, err := store.UndoStudy(chatID)
+	check(t, err)
+	if !undone {
+		t.Fatal("expected study to be undone")
+	}
+	if study, err := store.GetStudy(chatID); err != nil || study.Total != 1 || study.PhraseID != second {
+		t.Errorf("expected phrase %d to be studied again, got %+v: %v", second, study, err)
+	}
+
+	// The limit applies right away
+	settings.NewPerDay = 3
+	check(t, store.SetUserSettings(chatID, settings))
+	if study, err := store.GetStudy(chatID); err != nil || study.Total != 2 {
+		t.Errorf("expected 2 studies after raising the limit, got %+v: %v", study, err)
+	}
+	settings.Timezone = 20
+	if err := store.SetUserSettings(chatID, settings); err != brain.ErrInvalidSettings {
+		t.Errorf("expected ErrInvalidSettings for timezone, got %v", err)
+	}
+
+	// Phrases studied before are not queued
+	check(t, store.StudyNow())
+	ids, err := store.ImportPhrases(chatID, []brain.Phrase{
+		{Phrase: "buenas", Explanation: "good day", ReviewState: brain.ReviewState{
+			Score:    1,
+			Reviewed: time.Now().Add(-48 * time.Hour),
+			Interval: 24 * time.Hour,
+		}},
+	})
+	check(t, err)
+	if study, err := store.GetStudy(chatID); err != nil || study.Total != 4 || study.PhraseID != ids[0] {
+		t.Errorf("expected imported phrase %d to be due, got %+v: %v", ids[0], study, err)
+	}
+}
+
+func testSettings(t *testing.T, store brain.Store) {
+	settings, err := store.GetUserSettings(chatID)
+	check(t, err)
+	if settings != brain.DefaultSettings() {
+		t.Errorf("expected default settings, got %+v", settings)
+	}
+	if err := store.SetUserSettings(chatID, brain.UserSettings{}); err != brain.ErrInvalidSettings {
+		t.Errorf("expected ErrInvalidSettings, got %v", err)
+	}
+
+	settings.NotifyMinCount = 2
+	settings.Direction = brain.DirectionBoth
+	check(t, store.SetUserSettings(chatID, settings))
+	if got, err := store.GetUserSettings(chatID); err != nil || got != settings {
+		t.Errorf("expected %+v, got %+v: %v", settings, got, err)
+	}
+	addPhrase(t, store, "hola", "hello")
+	check(t, store.StudyNow())
+	// Phrases of the default deck are studied in the direction from the settings
+	_, count, err := store.GetNotifyTime(chatID)
+	check(t, err)
+	if count != 2 {
+		t.Errorf("expected 2 studies, got %d", count)
+	}
+	deckID, err := store.AddDeck(chatID, "verbs")
+	check(t, err)
+	if deck, err := store.GetDeck(chatID, deckID); err != nil || deck.Direction != brain.DirectionBoth {
+		t.Errorf("expected new deck to use direction from settings, got %+v: %v", deck, err)
+	}
+}
+
+func testImport(t *testing.T, store brain.Store) {
+	addPhrase(t, store, "hola", "hello")
+	ids, err := store.ImportPhrases(chatID, []brain.Phrase{
+		{Phrase: "adios", Explanation: "bye", Tags: []string{"basics"}},
+		{Phrase: "buenas", Explanation: "hello"},
+		{Phrase: "chao", Explanation: "bye"},
+		{Phrase: "gracias", Explanation: "thanks", Alternatives: []string{"muchas gracias"}},
+	})
+	check(t, err)
+	if len(ids) != 4 || ids[0] == 0 || ids[1] != 0 || ids[2] != 0 || ids[3] == 0 {
+		t.Fatalf("expected duplicates to be skipped, got %v", ids)
+	}
+	p, err := store.GetPhrase(chatID, ids[0])
+	check(t, err)
+	if p.Phrase != "adios" || len(p.Tags) != 1 || p.Tags[0] != "basics" {
+		t.Errorf("expected imported phrase with tags, got %+v", p)
+	}
+	if p, err := store.GetPhrase(chatID, ids[3]); err != nil || len(p.Alternatives) != 1 {
+		t.Errorf("expected imported phrase with alternatives, got %+v: %v", p, err)
+	}
+	if study := studyNow(t, store); study.Total != 3 {
+		t.Errorf("expected 3 studies, got %d", study.Total)
+	}
+
+	// Review states are kept and cards with an interval are due after it
+	const otherChat = chatID + 1
+	ids, err = store.ImportPhrases(otherChat, []brain.Phrase{
+		{Phrase: "buenas", Explanation: "hello", ReviewState: brain.ReviewState{
+			Score:    4,
+			Reviewed: time.Now().Add(-47 * time.Hour),
+			Interval: 48 * time.Hour,
+		}},
+		{Phrase: "{{c1::Buenos}} {{c2::días}}", Explanation: "good morning", Cloze: true},
+	})
+	check(t, err)
+	if p, err := store.GetPhrase(otherChat, ids[0]); err != nil || p.Score != 4 {
+		t.Errorf("expected imported review state, got %+v: %v", p, err)
+	}
+	if p, err := store.GetPhrase(otherChat, ids[1]); err != nil || !p.Cloze {
+		t.Errorf("expected imported cloze phrase, got %+v: %v", p, err)
+	}
+	study, err := store.GetStudy(otherChat)
+	check(t, err)
+	if study.Total != 0 || study.Next <= 50*time.Minute || study.Next > time.Hour {
+		t.Errorf("expected next study in an hour, got %+v", study)
+	}
+	check(t, store.StudyNow())
+	if study, err := store.GetStudy(otherChat); err != nil || study.Total != 3 {
+		t.Errorf("expected 3 studies, got %+v: %v", study, err)
+	}
+}
+
+func testAdmin(t *testing.T, store brain.Store) {
+	addPhrase(t, store, "hola", "hello")
+	addPhrase(t, store, "adios", "bye")
+	deleted, err := store.DeletePhrases(func(id int64, p brain.Phrase) bool {
+		return id == chatID && p.Phrase == "adios"
+	})
+	check(t, err)
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted phrase, got %d", deleted)
+	}
+	if study := studyNow(t, store); study.Total != 1 {
+		t.Errorf("expected studies of deleted phrases to be gone, got %+v", study)
+	}
+	var buf bytes.Buffer
+	for _, f := range brain.Formats {
+		buf.Reset()
+		check(t, store.Export(chatID, f, &buf))
+		if !strings.Contains(buf.String(), "hola") {
+			t.Errorf("expected phrase in %s export, got %s", f, buf.String())
+		}
+	}
+	if err := store.Export(chatID, "xml", &buf); err != brain.ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+
+	check(t, store.SetMode(chatID, brain.ModeMenu))
+	check(t, store.DeleteChat(chatID))
+	if study := studyNow(t, store); study.Total != 0 || study.Next != 0 {
+		t.Errorf("expected no studies after deleting chat, got %+v", study)
+	}
+	if p, _ := store.FindPhrase(chatID, func(brain.Phrase) bool { return true }); p.Phrase != "" {
+		t.Errorf("expected no phrases after deleting chat, got %+v", p)
+	}
+}
+
+func testDeleteChat(t *testing.T, store brain.Store) {
+	const otherChat = chatID + 1
+	// Store something of the chat in every place there is
+	for _, id := range []int64{chatID, otherChat} {
+		check(t, store.SetMode(id, brain.ModeStudy))
+		_, err := store.AddPhrase(id, "hola", "hello")
+		check(t, err)
+		_, err = store.AddDeck(id, "verbs")
+		check(t, err)
+		_, err = store.AddCloze(id, "{{c1::comer}}", "to eat")
+		check(t, err)
+		check(t, store.StudyNow())
+		_, err = store.ScoreStudy(id, -1, brain.Answer{})
+		check(t, err)
+		settings := brain.DefaultSettings()
+		settings.NewPerDay++
+		check(t, store.SetUserSettings(id, settings))
+		check(t, store.Subscribe(id))
+		check(t, store.SetRead(id, time.Now().Add(-time.Hour)))
+		check(t, store.SetActivity(id, time.Now().Add(-time.Hour)))
+	}
+
+	check(t, store.DeleteChat(chatID))
+
+	if mode, err := store.GetMode(chatID); err != nil || mode != brain.ModeGetStarted {
+		t.Errorf("expected mode of deleted chat to be reset, got %d: %v", mode, err)
+	}
+	if ids, err := store.GetChatIDs(); err != nil || len(ids) != 1 || ids[0] != otherChat {
+		t.Errorf("expected only chat %d to be left, got %v: %v", otherChat, ids, err)
+	}
+	if p, err := store.FindPhrase(chatID, func(brain.Phrase) bool { return true }); err != nil || p.Phrase != "" {
+		t.Errorf("expected no phrases, got %+v: %v", p, err)
+	}
+	if study, err := store.GetStudy(chatID); err != nil || study.Total != 0 || study.Next != 0 {
+		t.Errorf("expected no studies, got %+v: %v", study, err)
+	}
+	if reviews, err := store.GetReviews(chatID); err != nil || len(reviews) != 0 {
+		t.Errorf("expected no reviews, got %+v: %v", reviews, err)
+	}
+	if undone, err := store.UndoStudy(chatID); err != nil || undone {
+		t.Errorf("expected nothing to undo, got %v: %v", undone, err)
+	}
+	if decks, err := store.GetDecks(chatID); err != nil || len(decks) != 1 {
+		t.Errorf("expected only the default deck, got %+v: %v", decks, err)
+	}
+	if settings, err := store.GetUserSettings(chatID); err != nil || settings != brain.DefaultSettings() {
+		t.Errorf("expected default settings, got %+v: %v", settings, err)
+	}
+	if subscribed, err := store.IsSubscribed(chatID); err != nil || subscribed {
+		t.Errorf("expected no subscription, got %v: %v", subscribed, err)
+	}
+	var active []int64
+	check(t, store.EachActiveChat(func(id int64) { active = append(active, id) }))
+	for _, id := range active {
+		if id == chatID {
+			t.Errorf("expected deleted chat not to be active")
+		}
+	}
+
+	// Other chats are untouched
+	if reviews, err := store.GetReviews(otherChat); err != nil || len(reviews) != 1 {
+		t.Errorf("expected reviews of other chat to be kept, got %+v: %v", reviews, err)
+	}
+	if study, err := store.GetStudy(otherChat); err != nil || study.Total != 1 {
+		t.Errorf("expected studies of other chat to be kept, got %+v: %v", study, err)
+	}
+	if subscribed, err := store.IsSubscribed(otherChat); err != nil || !subscribed {
+		t.Errorf("expected subscription of other chat to be kept, got %v: %v", subscribed, err)
+	}
+}
+
+// Expects learning steps of 1 and 10 minutes.
+func testLearningSteps(t *testing.T, store brain.Store) {
+	id := addPhrase(t, store, "hola", "hello")
+	studyNow(t, store)
+	score := func(grade, step, points int) {
+		t.Helper()
+		_, err := store.ScoreStudy(chatID, grade, brain.Answer{})
+		check(t, err)
+		p, err := store.GetPhrase(chatID, id)
+		check(t, err)
+		if p.Step != step || p.Score != points {
+			t.Fatalf("expected step %d and score %d, got %+v", step, points, p.ReviewState)
+		}
+	}
+	// Cards in learning are studied early when nothing else is due
+	learning := func() {
+		t.Helper()
+		study, err := store.GetStudy(chatID)
+		check(t, err)
+		if study.Total != 1 || study.PhraseID != id {
+			t.Fatalf("expected phrase in learning to be studied again, got %+v", study)
+		}
+	}
+
+	// A new card not known starts with the first step
+	score(-1, 1, 0)
+	learning()
+	score(1, 2, 0)
+	learning()
+	score(0, 2, 0)
+	learning()
+	// Graduates after the last step
+	score(1, 0, 1)
+	study, err := store.GetStudy(chatID)
+	check(t, err)
+	if study.Total != 0 || study.Next < time.Hour {
+		t.Errorf("expected graduated phrase to be scheduled, got %+v", study)
+	}
+
+	// A lapsed card is relearned and continues with the interval set when it lapsed
+	studyNow(t, store)
+	score(-1, 1, 0)
+	p, err := store.GetPhrase(chatID, id)
+	check(t, err)
+	interval := p.Interval
+	learning()
+	score(1, 2, 0)
+	learning()
+	score(1, 0, 0)
+	study, err = store.GetStudy(chatID)
+	check(t, err)
+	if study.Total != 0 || study.Next < interval-time.Minute || study.Next > interval+time.Hour {
+		t.Errorf("expected relearned phrase to be due in %s, got %+v", interval, study)
+	}
+	if p.Lapses != 2 {
+		t.Errorf("expected 2 lapses, got %d", p.Lapses)
+	}
+}
+
+// Expects a leech threshold of 1.
+func testLeechDirections(t *testing.T, store brain.Store) {
+	id := addPhrase(t, store, "hola", "hello")
+	check(t, store.SetPhraseDirection(chatID, id, brain.DirectionBoth))
+	testLeechCards(t, store, id, 2)
+}
+
+// Expects a leech threshold of 1.
+func testLeechClozes(t *testing.T, store brain.Store) {
+	id, err := store.AddCloze(chatID, "{{c1::yo}} {{c2::tengo}} {{c3::un}} gato", "")
+	check(t, err)
+	testLeechCards(t, store, id, 3)
+}
+
+// Check that none of the cards of a phrase are studied
+// once one of them makes it a leech
+// and that all of them come back after undoing the lapse or unsuspending the phrase.
+func testLeechCards(t *testing.T, store brain.Store, id int64, cards int) {
+	expectDue := func(n int) {
+		t.Helper()
+		study, err := store.GetStudy(chatID)
+		check(t, err)
+		if study.Total != n || (n > 0 && study.PhraseID != id) {
+			t.Errorf("expected %d studies of phrase %d, got %+v", n, id, study)
+		}
+		_, count, err := store.GetNotifyTime(chatID)
+		check(t, err)
+		if count != n {
+			t.Errorf("expected %d studies to notify about, got %d", n, count)
+		}
+	}
+	suspend := func() {
+		t.Helper()
+		suspended, err := store.ScoreStudy(chatID, -1, brain.Answer{})
+		check(t, err)
+		if !suspended {
+			t.Fatal("expected phrase to be suspended")
+		}
+		expectDue(0)
+	}
+
+	// Take the phrase from the queue of new phrases so undoing doesn't put it back
+	studyNow(t, store)
+	_, err := store.ScoreStudy(chatID, 1, brain.Answer{})
+	check(t, err)
+	if study := studyNow(t, store); study.Total != cards {
+		t.Fatalf("expected %d studies, got %+v", cards, study)
+	}
+	suspend()
+	undone, err := store.UndoStudy(chatID)
+	check(t, err)
+	if !undone {
+		t.Fatal("expected study to be undone")
+	}
+	expectDue(cards)
+
+	suspend()
+	check(t, store.UnsuspendPhrase(chatID, id))
+	studyNow(t, store)
+	expectDue(cards)
+}
@@ -1,7 +1,6 @@
 package brain
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,183 +12,434 @@ import (
 )
 
 // GetStudy returns the current study the user needs to do.
-func (store Store) GetStudy(chatID int64) (Study, error) {
+func (store Bolt) GetStudy(chatID int64) (Study, error) {
 	var study Study
 	err := store.db.View(func(tx *bolt.Tx) error {
-		c := tx.Bucket(bucketStudytimes).Cursor()
 		now := time.Now().Unix()
-		prefix := itob(chatID)
-		total := 0
-		var keyTime int64
-		var key []byte
+		key, keyTime, total, err := findStudy(tx, chatID, now)
+		if err != nil {
+			return err
+		}
+		bp := tx.Bucket(bucketPhrases)
+		study, err = foundStudy(key, keyTime, total, now, func(key []byte) (Phrase, error) {
+			var p Phrase
+			err := json.Unmarshal(bp.Get(phraseKey(key)), &p)
+			return p, err
+		})
+		return err
+	})
 
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
-			timestamp, err := btoi(v)
-			if err != nil {
-				return err
-			}
-			if timestamp < keyTime || keyTime == 0 {
-				keyTime = timestamp
-				key = k
-			}
-			if timestamp <= now {
-				total++
-			}
+	if err != nil {
+		return study, fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
+	}
+	return study, nil
+}
+
+// Create the study found by findStudy.
+// If no studies are due, only the time until the next study is set.
+// getPhrase returns the phrase of a studytimes key.
+func foundStudy(key []byte, keyTime int64, total int, now int64, getPhrase func([]byte) (Phrase, error)) (Study, error) {
+	if total == 0 {
+		if key != nil {
+			return Study{Next: time.Second * time.Duration(keyTime-now)}, nil
 		}
+		return Study{}, nil
+	}
+	p, err := getPhrase(key)
+	if err != nil {
+		return Study{}, err
+	}
+	return newStudy(key, p, total)
+}
 
-		// No studies found
-		if total == 0 {
-			if keyTime > 0 {
-				study = Study{Next: time.Second * time.Duration(keyTime-now)}
-			}
-			return nil
+// Create the study for the card with the given studytimes key.
+func newStudy(key []byte, p Phrase, total int) (Study, error) {
+	phraseID, err := btoi(key[8:phraseKeyLen])
+	if err != nil {
+		return Study{}, err
+	}
+	study := Study{
+		PhraseID:     phraseID,
+		Phrase:       p.Phrase,
+		Alternatives: p.Alternatives,
+		Explanation:  p.Explanation,
+		Total:        total,
+	}
+	if isReverse(key) {
+		study.Phrase, study.Explanation = p.Explanation, p.Phrase
+		study.Alternatives = nil
+		study.Reverse = true
+	}
+	if i := clozeIndex(key); i > 0 {
+		study.Explanation, study.Phrase = renderCloze(p.Phrase, i)
+		if p.Explanation != "" {
+			study.Explanation += "\n\n" + p.Explanation
 		}
+		study.Cloze = true
+	}
+	return study, nil
+}
 
-		// Get study from phrase
+// Find the study of a chat with the earliest study time.
+// Only phrases of the decks the chat is studying are considered
+// and suspended phrases are skipped.
+// New phrases are only considered as long as they can be taken from the queue today.
+// Returns the key and study time of the study
+// and the number of studies due at the given time.
+// If no studies are due, a card in learning is counted as due
+// when it's due within learnAhead.
+// The key is nil if there are no studies.
+// Only the studies due at the given time and the first one after are read from the due index;
+// phrases in the queue and suspended phrases are not part of it.
+func findStudy(tx *bolt.Tx, chatID int64, now int64) ([]byte, int64, int, error) {
+	inDeck, err := studyFilter(tx, chatID)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	front, waiting, err := frontOfQueue(tx, chatID, time.Unix(now, 0), inDeck)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	due, err := newDueCursor(tx, chatID)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	bp := tx.Bucket(bucketPhrases)
+	return pickStudy(now, due, front, waiting, func(key []byte) (Phrase, error) {
 		var p Phrase
-		if err := json.Unmarshal(tx.Bucket(bucketPhrases).Get(key), &p); err != nil {
-			return err
-		}
-		study = Study{
-			Phrase:      p.Phrase,
-			Explanation: p.Explanation,
-			Total:       total,
-		}
-		return nil
+		err := json.Unmarshal(bp.Get(phraseKey(key)), &p)
+		return p, err
 	})
+}
 
-	if err != nil {
-		return study, fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
+// Choose the study with the earliest study time
+// from the due studies and the cards at the front of the queue of new phrases.
+// The card waiting in the queue is only chosen if nothing else is due.
+// getPhrase returns the phrase of a studytimes key.
+// See findStudy for the returned values.
+func pickStudy(now int64, due studyCursor, front []dueCard, waiting *dueCard, getPhrase func([]byte) (Phrase, error)) ([]byte, int64, int, error) {
+	total := 0
+	var keyTime int64
+	var key []byte
+
+	for studyKey, timestamp := due.first(); studyKey != nil; studyKey, timestamp = due.next() {
+		if key == nil {
+			keyTime = timestamp
+			key = studyKey
+		}
+		if timestamp > now {
+			break
+		}
+		total++
 	}
-	return study, nil
+	for _, card := range front {
+		if key == nil || card.time < keyTime {
+			keyTime = card.time
+			key = card.key
+		}
+		if card.time <= now {
+			total++
+		}
+	}
+	if waiting != nil && total == 0 && (key == nil || waiting.time < keyTime) {
+		key = waiting.key
+		keyTime = waiting.time
+	}
+	if total == 0 && key != nil && keyTime-now <= int64(learnAhead/time.Second) {
+		p, err := getPhrase(key)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if isLearning(p, key) {
+			total = 1
+		}
+	}
+	return key, keyTime, total, nil
+}
+
+// Check if the card with the given studytimes key is in a learning step.
+func isLearning(p Phrase, key []byte) bool {
+	state := p.cardState(key)
+	return state != nil && state.Step > 0
 }
 
 // ScoreStudy sets the score of the current study and moves to the next study.
-func (store Store) ScoreStudy(chatID int64, score int) error {
+// Each study is recorded in the review log together with the given answer.
+// A negative score counts as lapse of the phrase.
+// Returns true if the phrase has been suspended because of too many lapses.
+func (store Bolt) ScoreStudy(chatID int64, score int, answer Answer) (bool, error) {
+	suspended := false
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		bs := tx.Bucket(bucketStudytimes)
-		c := bs.Cursor()
 		now := time.Now()
-		uNow := now.Unix()
-		prefix := itob(chatID)
-		var keyTime int64
-		var key []byte
-
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
-			timestamp, err := btoi(v)
-			if err != nil {
-				return err
-			}
-			if timestamp > uNow {
-				continue
-			}
-			if timestamp < keyTime || keyTime == 0 {
-				keyTime = timestamp
-				key = k
-			}
+		key, _, total, err := findStudy(tx, chatID, now.Unix())
+		if err != nil {
+			return err
 		}
 
 		// No studies found
-		if key == nil {
+		if total == 0 {
 			return errors.New("no study found")
 		}
 
 		// Get phrase
 		var p Phrase
 		bp := tx.Bucket(bucketPhrases)
-		if err := json.Unmarshal(bp.Get(key), &p); err != nil {
+		pKey := phraseKey(key)
+		if err := json.Unmarshal(bp.Get(pKey), &p); err != nil {
 			return err
 		}
-
-		// Update score
-		p.Score += score
-		newScore := p.Score
-		if newScore < 0 {
-			newScore = 0
+		snapshot := undo{
+			Card:      append([]byte(nil), key...),
+			Phrase:    append([]byte(nil), bp.Get(pKey)...),
+			Studytime: append([]byte(nil), bs.Get(key)...),
+		}
+		snapshot.Queued, err = takeFromQueue(tx, chatID, key, now)
+		if err != nil {
+			return err
 		}
+		wasSuspended := p.Suspended
+		r, next, err := store.opts.scoreCard(&p, key, score, now)
+		if err != nil {
+			return err
+		}
+		suspended = p.Suspended
 
 		// Save phrase
 		buf, err := json.Marshal(p)
 		if err != nil {
 			return err
 		}
-		if err = bp.Put(key, buf); err != nil {
+		if err = bp.Put(pKey, buf); err != nil {
 			return err
 		}
 
 		// Update study time
-		// Randomize order by spreading studies over a period of time
-		diffusion := time.Duration(rand.Intn(studyTimeDiffusion)) * time.Minute
-		next := itob(now.Add((baseStudytime<<uint(newScore))*time.Hour + diffusion).Unix())
-		if err = bs.Put(key, next); err != nil {
+		if err = putStudytime(tx, key, next.Unix()); err != nil {
 			return err
 		}
+		// None of the cards of a suspended phrase are studied anymore
+		if suspended && !wasSuspended {
+			if err := unindexPhrase(tx, pKey); err != nil {
+				return err
+			}
+		}
 
-		return nil
+		// Log review
+		r.ChatID = chatID
+		r.Answer = answer
+		snapshot.Review, err = addReview(tx, r)
+		if err != nil {
+			return err
+		}
+		return putUndo(tx, chatID, snapshot)
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
+		return suspended, fmt.Errorf("failed to study with chatID %d: %v", chatID, err)
 	}
-	return nil
+	return suspended, nil
+}
+
+// Update the review state of the card with the given studytimes key.
+// Returns the review to log and the next study time.
+// The phrase is suspended if it has been forgotten too often.
+func (o Options) scoreCard(p *Phrase, key []byte, score int, now time.Time) (Review, time.Time, error) {
+	phraseID, err := btoi(key[8:phraseKeyLen])
+	if err != nil {
+		return Review{}, now, err
+	}
+	state := &p.ReviewState
+	if isReverse(key) {
+		if p.Reverse == nil {
+			p.Reverse = &ReviewState{}
+		}
+		state = p.Reverse
+	}
+	cloze := clozeIndex(key)
+	if cloze > 0 {
+		if p.Clozes == nil {
+			p.Clozes = map[int]*ReviewState{}
+		}
+		if p.Clozes[cloze] == nil {
+			p.Clozes[cloze] = &ReviewState{}
+		}
+		state = p.Clozes[cloze]
+	}
+
+	// Update score and schedule next study
+	prevInterval := state.Interval
+	next, learning := o.learn(state, score, now)
+	if !learning {
+		state.Score += score
+		state.Step = 0
+		*state, next = o.Scheduler.Next(*state, score, now)
+		state.Interval = next.Sub(now)
+		// Relearn lapsed cards before continuing with the new interval
+		if score < 0 && len(o.LearningSteps) > 0 {
+			state.Step = 1
+			next = now.Add(o.LearningSteps[0])
+		}
+	}
+	state.Reviewed = now
+	state.Lapsed = score < 0
+
+	// Suspend phrases that are forgotten over and over again
+	if score < 0 {
+		p.Lapses++
+		p.Suspended = o.LeechThreshold > 0 && p.Lapses >= o.LeechThreshold
+	}
+
+	r := Review{
+		PhraseID:     phraseID,
+		Reverse:      isReverse(key),
+		Cloze:        cloze,
+		Time:         now,
+		Grade:        score,
+		PrevInterval: prevInterval,
+		Interval:     next.Sub(now),
+	}
+	// Learning steps are too short to be mixed up
+	if state.Step > 0 {
+		return r, next, nil
+	}
+	// Randomize order by spreading studies over a period of time
+	diffusion := time.Duration(rand.Intn(studyTimeDiffusion)) * time.Minute
+	return r, next.Add(diffusion), nil
+}
+
+// Move a new card or a card in learning to its next learning step.
+// Returns the next study time and true if the card is scheduled by the learning steps.
+// Returns false if the Scheduler needs to schedule the card.
+func (o Options) learn(state *ReviewState, score int, now time.Time) (time.Time, bool) {
+	steps := o.LearningSteps
+	if len(steps) == 0 || (state.Step == 0 && !state.Reviewed.IsZero()) {
+		return now, false
+	}
+	// New cards are at the first step
+	step := state.Step
+	if step == 0 {
+		step = 1
+	}
+	if score < 0 {
+		step = 1
+	} else if score > 0 {
+		step++
+	}
+	if step <= len(steps) {
+		state.Step = step
+		return now.Add(steps[step-1]), true
+	}
+	// Graduate; relearned cards continue with the interval set when they lapsed
+	state.Step = 0
+	if state.Interval > 0 {
+		return now.Add(state.Interval), true
+	}
+	return now, false
 }
 
 // GetNotifyTime gets the time until the user should be notified to study.
+// Only phrases of the decks the chat is studying are considered
+// and suspended phrases are skipped.
+// New phrases only count as long as they can be taken from the queue today.
+// The user is notified once UserSettings.NotifyMinCount studies are due.
 // Returns the time until the next studies are ready and a count of the ready studies.
 // The returned duration is always at least dueMinInactive.
-// The count is 0 if the chat has no phrases yet.
-func (store Store) GetNotifyTime(chatID int64) (time.Duration, int, error) {
-	due := 0
-	now := time.Now()
-	minTime := now.Add(dueMinInactive).Unix()
-	var next sortableInts
-
+// The count is 0 if the chat has no phrases yet or if it is paused.
+func (store Bolt) GetNotifyTime(chatID int64) (time.Duration, int, error) {
+	var timestamps []int64
+	var minCount int
 	err := store.db.View(func(tx *bolt.Tx) error {
-		c := tx.Bucket(bucketStudytimes).Cursor()
-		prefix := itob(chatID)
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
-			timestamp, err := btoi(v)
-			if err != nil {
-				return err
-			}
-			if timestamp < minTime {
-				due++
-			}
-			if due >= dueMinCount {
-				continue
-			}
-			l := len(next)
-			if l < dueMinCount {
-				next = append(next, timestamp)
-				sort.Sort(next)
-				continue
-			}
-			if timestamp < next[l-1] {
-				next = append(next[:l-1], timestamp)
-				sort.Sort(next)
-			}
+		if since, err := pausedSince(tx, chatID); err != nil || !since.IsZero() {
+			return err
 		}
+		inDeck, err := studyFilter(tx, chatID)
+		if err != nil {
+			return err
+		}
+		settings, err := getUserSettings(tx, chatID)
+		if err != nil {
+			return err
+		}
+		front, _, err := frontOfQueue(tx, chatID, time.Now(), inDeck)
+		if err != nil {
+			return err
+		}
+		minCount = settings.NotifyMinCount
+		due, err := newDueCursor(tx, chatID)
+		if err != nil {
+			return err
+		}
+		timestamps = notifyTimestamps(due, front, minCount, time.Now())
 		return nil
 	})
 
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get next studies for chat %d: %v", chatID, err)
 	}
+	d, count := notifyTime(timestamps, minCount, time.Now())
+	return d, count, nil
+}
+
+// Get the study times needed by notifyTime
+// from the due studies and the cards at the front of the queue of new phrases.
+// Only the studies due soon and the next needed studies are read.
+func notifyTimestamps(due studyCursor, front []dueCard, needed int, now time.Time) []int64 {
+	var timestamps []int64
+	minTime := now.Add(dueMinInactive).Unix()
+	for studyKey, timestamp := due.first(); studyKey != nil; studyKey, timestamp = due.next() {
+		if timestamp >= minTime && len(timestamps) >= needed {
+			break
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+	for _, card := range front {
+		timestamps = append(timestamps, card.time)
+	}
+	return timestamps
+}
+
+// Calculate the time until notifying from the study times of a chat
+// and the number of studies needed to be due.
+// It's enough to pass the study times due before dueMinInactive
+// and the earliest needed study times.
+func notifyTime(timestamps []int64, needed int, now time.Time) (time.Duration, int) {
+	due := 0
+	minTime := now.Add(dueMinInactive).Unix()
+	var next sortableInts
+	for _, timestamp := range timestamps {
+		if timestamp < minTime {
+			due++
+		}
+		if due >= needed {
+			continue
+		}
+		l := len(next)
+		if l < needed {
+			next = append(next, timestamp)
+			sort.Sort(next)
+			continue
+		}
+		if timestamp < next[l-1] {
+			next = append(next[:l-1], timestamp)
+			sort.Sort(next)
+		}
+	}
 
-	minCount := dueMinCount
+	minCount := needed
 	l := len(next)
 	if minCount > l {
 		minCount = l
 	}
 	if due >= minCount {
-		return dueMinInactive, due, nil
+		return dueMinInactive, due
 	}
-	return time.Unix(next[l-1], 0).Sub(now), l, nil
+	return time.Unix(next[l-1], 0).Sub(now), l
 }
 
 // EachActiveChat runs a function for each chat
 // where the user has been active since the last notification has been sent.
-func (store Store) EachActiveChat(fn func(int64)) error {
+func (store Bolt) EachActiveChat(fn func(int64)) error {
 	return store.db.View(func(tx *bolt.Tx) error {
 		active := tx.Bucket(bucketActivities)
 		return tx.Bucket(bucketReads).ForEach(func(k, v []byte) error {
@@ -7,7 +7,7 @@ import (
 )
 
 // IsSubscribed checks if a user has notifications enabled.
-func (store Store) IsSubscribed(chatID int64) (bool, error) {
+func (store Bolt) IsSubscribed(chatID int64) (bool, error) {
 	var isSubscribed bool
 	err := store.db.View(func(tx *bolt.Tx) error {
 		isSubscribed = tx.Bucket(bucketSubscriptions).Get(itob(chatID)) != nil
@@ -20,7 +20,7 @@ func (store Store) IsSubscribed(chatID int64) (bool, error) {
 }
 
 // Subscribe enables notifications for a user.
-func (store Store) Subscribe(chatID int64) error {
+func (store Bolt) Subscribe(chatID int64) error {
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		return tx.Bucket(bucketSubscriptions).Put(itob(chatID), []byte{'1'})
 	})
@@ -31,7 +31,7 @@ func (store Store) Subscribe(chatID int64) error {
 }
 
 // Unsubscribe disables notifications for a user.
-func (store Store) Unsubscribe(chatID int64) error {
+func (store Bolt) Unsubscribe(chatID int64) error {
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		return tx.Bucket(bucketSubscriptions).Delete(itob(chatID))
 	})
@@ -0,0 +1,108 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Snapshot of a card taken before it has been scored.
+// Only the latest study of each chat can be undone.
+// Undoing restores the whole phrase;
+// the snapshot is dropped when the phrase is changed in any other way,
+// so undoing never reverts an edit or reset.
+type undo struct {
+	// Card is the key of the card in bucketStudytimes.
+	Card []byte
+	// Phrase is the phrase JSON before the study.
+	Phrase []byte
+	// Studytime is the study time of the card before the study.
+	Studytime []byte
+	// Review is the key of the review logged for the study.
+	Review []byte
+	// Queued is true if the study took the phrase from the queue of new phrases.
+	Queued bool `json:",omitempty"`
+}
+
+func putUndo(tx *bolt.Tx, chatID int64, u undo) error {
+	buf, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketUndos).Put(itob(chatID), buf)
+}
+
+// Drop the undo snapshot of a chat if it belongs to the phrase with the given key.
+func dropUndo(tx *bolt.Tx, key []byte) error {
+	bu := tx.Bucket(bucketUndos)
+	chatID := key[:8]
+	v := bu.Get(chatID)
+	if v == nil {
+		return nil
+	}
+	var u undo
+	if err := json.Unmarshal(v, &u); err != nil {
+		return err
+	}
+	if !bytes.Equal(phraseKey(u.Card), key) {
+		return nil
+	}
+	return bu.Delete(chatID)
+}
+
+// UndoStudy reverts the latest ScoreStudy of a chat.
+// Phrase, study time and review log are restored to the state before the study,
+// so the same study is the current one again.
+// Returns false if there is nothing to undo.
+func (store Bolt) UndoStudy(chatID int64) (bool, error) {
+	undone := false
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bu := tx.Bucket(bucketUndos)
+		v := bu.Get(itob(chatID))
+		if v == nil {
+			return nil
+		}
+		var u undo
+		if err := json.Unmarshal(v, &u); err != nil {
+			return err
+		}
+		if err := bu.Delete(itob(chatID)); err != nil {
+			return err
+		}
+		// Don't bring back cards which have been deleted in the meantime
+		bp := tx.Bucket(bucketPhrases)
+		bs := tx.Bucket(bucketStudytimes)
+		pKey := phraseKey(u.Card)
+		if bp.Get(pKey) == nil || bs.Get(u.Card) == nil {
+			return nil
+		}
+		if err := bp.Put(pKey, u.Phrase); err != nil {
+			return err
+		}
+		studytime, err := btoi(u.Studytime)
+		if err != nil {
+			return err
+		}
+		if err := putStudytime(tx, u.Card, studytime); err != nil {
+			return err
+		}
+		// The restored phrase might not be suspended anymore
+		if err := indexPhrase(tx, pKey); err != nil {
+			return err
+		}
+		if u.Queued {
+			if err := returnToQueue(tx, chatID, u.Card, time.Now()); err != nil {
+				return err
+			}
+		}
+		undone = true
+		return tx.Bucket(bucketReviews).Delete(u.Review)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to undo study for chatID %d: %v", chatID, err)
+	}
+	return undone, nil
+}
@@ -3,17 +3,16 @@ package brain
 import (
 	"bytes"
 	"encoding/json"
-	"io"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/boltdb/bolt"
 )
 
 // BackupTo streams backup as an HTTP response.
-func (store Store) BackupTo(w http.ResponseWriter) {
+func (store Bolt) BackupTo(w http.ResponseWriter) {
 	err := store.db.View(func(tx *bolt.Tx) error {
 		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Content-Disposition", `attachment; filename="my.db"`)
@@ -27,46 +26,53 @@ func (store Store) BackupTo(w http.ResponseWriter) {
 }
 
 // StudyNow resets all study times of all users to now.
-func (store Store) StudyNow() error {
+func (store Bolt) StudyNow() error {
 	return store.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucketStudytimes)
-		now := itob(time.Now().Unix())
-		return b.ForEach(func(k, v []byte) error {
-			return b.Put(k, now)
+		now := time.Now().Unix()
+		err := b.ForEach(func(k, v []byte) error {
+			return b.Put(k, itob(now))
 		})
+		if err != nil {
+			return err
+		}
+		// All cards move so the due indexes are rebuilt from scratch
+		return reindexStudytimes(tx)
 	})
 }
 
 // DeleteChat removes all records of a given chat.
-func (store Store) DeleteChat(chatID int64) error {
-	return store.db.Update(func(tx *bolt.Tx) error {
-		key := itob(chatID)
-		// Remove mode
-		if err := tx.Bucket(bucketModes).Delete(key); err != nil {
-			return err
-		}
-		// Remove phrases
-		bp := tx.Bucket(bucketPhrases)
-		c := bp.Cursor()
-		for k, _ := c.Seek(key); k != nil && bytes.HasPrefix(k, key); k, _ = c.Next() {
-			if err := bp.Delete(k); err != nil {
-				return err
+// All buckets are searched for keys of the chat,
+// so data stored in new buckets is removed as well.
+func (store Bolt) DeleteChat(chatID int64) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		prefix := itob(chatID)
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if bytes.Equal(name, bucketMeta) {
+				return nil
 			}
-		}
-		// Remove study times
-		bs := tx.Bucket(bucketStudytimes)
-		c = bp.Cursor()
-		for k, _ := c.Seek(key); k != nil && bytes.HasPrefix(k, key); k, _ = c.Next() {
-			if err := bs.Delete(k); err != nil {
-				return err
+			// Collect keys first since deleting while iterating skips keys
+			var keys [][]byte
+			c := b.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				keys = append(keys, append([]byte(nil), k...))
 			}
-		}
-		return nil
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return fmt.Errorf("bucket %s: %v", name, err)
+				}
+			}
+			return nil
+		})
 	})
+	if err != nil {
+		return fmt.Errorf("failed to delete chatID %d: %v", chatID, err)
+	}
+	return nil
 }
 
 // GetChatIDs returns chatIDs of all users.
-func (store Store) GetChatIDs() ([]int64, error) {
+func (store Bolt) GetChatIDs() ([]int64, error) {
 	var ids []int64
 	err := store.db.View(func(tx *bolt.Tx) error {
 		return tx.Bucket(bucketModes).ForEach(func(k, v []byte) error {
@@ -81,26 +87,11 @@ func (store Store) GetChatIDs() ([]int64, error) {
 	return ids, err
 }
 
-// GetPhrasesAsJSON ...
-func (store Store) GetPhrasesAsJSON(chatID int64) (io.Reader, error) {
-	var phrases string
-	err := store.db.View(func(tx *bolt.Tx) error {
-		c := tx.Bucket(bucketPhrases).Cursor()
-		prefix := itob(chatID)
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
-			phrases += string(v) + "\n"
-		}
-		return nil
-	})
-	return strings.NewReader(phrases), err
-}
-
 // DeletePhrases removes all phrases fn matches.
-func (store Store) DeletePhrases(fn func(int64, Phrase) bool) (int, error) {
+func (store Bolt) DeletePhrases(fn func(int64, Phrase) bool) (int, error) {
 	deleted := 0
 	err := store.db.Update(func(tx *bolt.Tx) error {
 		bp := tx.Bucket(bucketPhrases)
-		bs := tx.Bucket(bucketStudytimes)
 		return bp.ForEach(func(k, v []byte) error {
 			id, err := btoi(k[:8])
 			if err != nil {
@@ -113,7 +104,7 @@ func (store Store) DeletePhrases(fn func(int64, Phrase) bool) (int, error) {
 			if !fn(int64(id), p) {
 				return nil
 			}
-			if err := bs.Delete(k); err != nil {
+			if err := deleteStudytimes(tx, k); err != nil {
 				return err
 			}
 			if err := bp.Delete(k); err != nil {
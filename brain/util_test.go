@@ -0,0 +1,91 @@
+package brain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Store data of a chat in as many buckets as possible.
+func populateChat(t *testing.T, store *Bolt, chatID int64) {
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(store.SetMode(chatID, ModeAdd))
+	deckID, err := store.AddDeck(chatID, "deck")
+	check(err)
+	check(store.SetDeckSettings(chatID, DeckSettings{Current: deckID, StudyAll: true}))
+	check(store.SetUserSettings(chatID, DefaultSettings()))
+	for _, p := range []string{"uno", "dos", "tres"} {
+		_, err := store.AddPhrase(chatID, p, p)
+		check(err)
+	}
+	check(store.StudyNow())
+	_, err = store.ScoreStudy(chatID, 1, Answer{Typed: true})
+	check(err)
+	check(store.SetActivity(chatID, time.Now()))
+	check(store.SetRead(chatID, time.Now()))
+	_, err = store.SpreadBacklog(chatID, time.Now())
+	check(err)
+	check(store.Subscribe(chatID))
+	check(store.Pause(chatID, time.Now()))
+}
+
+// Count the keys of a chat in each bucket.
+func countKeys(t *testing.T, store *Bolt, chatID int64) map[string]int {
+	counts := map[string]int{}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		prefix := itob(chatID)
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			c := b.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				counts[string(name)]++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return counts
+}
+
+func TestDeleteChat(t *testing.T) {
+	store, cleanup := openTestBolt(t)
+	defer cleanup()
+	const deleted, kept = 1, 2
+	populateChat(t, store, deleted)
+	populateChat(t, store, kept)
+
+	before := countKeys(t, store, kept)
+	counts := countKeys(t, store, deleted)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if !bytes.Equal(name, bucketMeta) && counts[string(name)] == 0 {
+				t.Errorf("expected bucket %s to have data of the chat", name)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteChat(deleted); err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range countKeys(t, store, deleted) {
+		t.Errorf("expected no keys of the deleted chat, got %d in bucket %s", n, name)
+	}
+	after := countKeys(t, store, kept)
+	for name, n := range before {
+		if after[name] != n {
+			t.Errorf("expected %d keys of the other chat in bucket %s, got %d", n, name, after[name])
+		}
+	}
+}
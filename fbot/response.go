@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 )
 
 // URL to send messages to;
@@ -48,6 +51,54 @@ func (c Client) Send(id int64, message string, buttons []Button) error {
 	return checkError(resp.Body)
 }
 
+// SendFile sends a file as attachment to a user.
+// The name is the file name displayed to the user.
+func (c Client) SendFile(id int64, name, contentType string, file io.Reader) error {
+	recipient, err := json.Marshal(recipient{ID: id})
+	if err != nil {
+		return err
+	}
+	message, err := json.Marshal(attachmentMessage{Attachment: attachment{Type: "file", Payload: struct{}{}}})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("recipient", string(recipient)); err != nil {
+		return err
+	}
+	if err := w.WriteField("message", string(message)); err != nil {
+		return err
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="filedata"; filename="%s"`, name))
+	h.Set("Content-Type", contentType)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf(sendMessageURL, c.api, c.token)
+	resp, err := http.Post(url, w.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == 200 {
+		return nil
+	}
+	return checkError(resp.Body)
+}
+
 type sendMessage struct {
 	Recipient recipient   `json:"recipient"`
 	Message   messageData `json:"message"`
@@ -67,3 +118,12 @@ type quickReply struct {
 	Title       string `json:"title,omitempty"`
 	Payload     string `json:"payload"`
 }
+
+type attachmentMessage struct {
+	Attachment attachment `json:"attachment"`
+}
+
+type attachment struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
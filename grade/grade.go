@@ -0,0 +1,241 @@
+// Package grade compares answers typed by users with the expected phrase.
+// Besides exact matches it detects answers that are close to the phrase:
+// answers with a few typos or with missing diacritics.
+package grade
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Result describes how well an answer matches the expected phrase.
+type Result int
+
+const (
+	// Wrong answers don't match the phrase.
+	Wrong Result = iota
+	// Close answers have small typos or differ only in diacritics.
+	Close
+	// Exact answers match the phrase apart from case, punctuation and parts in parentheses.
+	Exact
+)
+
+// Everything that is not in the unicode character classes
+// for letters or numeric values
+// See: http://www.fileformat.info/info/unicode/category/index.htm
+var specialChars = regexp.MustCompile(`[^\p{Ll}\p{Lm}\p{Lo}\p{Lu}\p{Nd}\p{Nl}\p{No}]`)
+
+var inParantheses = regexp.MustCompile(`\(.*?\)`)
+
+// Language contains the rules for comparing answers in a language.
+type Language struct {
+	// Keep contains letters with diacritics that are letters of their own in the language.
+	// They are not folded and a different letter counts as a typo.
+	Keep string
+	// Replace contains pairs of old and new strings that are replaced before folding,
+	// for example to accept "ss" for "ß".
+	Replace []string
+}
+
+// Languages contains rules for languages by their ISO 639-1 code.
+// Unknown languages fold all diacritics.
+var Languages = map[string]Language{
+	"da": {Keep: "æøå"},
+	"de": {Replace: []string{"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss"}},
+	"es": {Keep: "ñ"},
+	"fi": {Keep: "äö"},
+	"no": {Keep: "æøå"},
+	"sv": {Keep: "åäö"},
+	"tr": {Keep: "çğıöşü"},
+}
+
+// Letters and the diacritic variants folded to them
+var foldings = []string{
+	"a", "àáâãäåāăą",
+	"c", "çćĉċč",
+	"d", "ďđ",
+	"e", "èéêëēĕėęě",
+	"g", "ĝğġģ",
+	"h", "ĥħ",
+	"i", "ìíîïĩīĭįı",
+	"j", "ĵ",
+	"k", "ķ",
+	"l", "ĺļľŀł",
+	"n", "ñńņňŉ",
+	"o", "òóôõöøōŏő",
+	"r", "ŕŗř",
+	"s", "śŝşšș",
+	"t", "ţťŧț",
+	"u", "ùúûüũūŭůűų",
+	"w", "ŵ",
+	"y", "ýÿŷ",
+	"z", "źżž",
+	"ae", "æ",
+	"oe", "œ",
+	"ss", "ß",
+}
+
+// Grader grades answers using the rules of a language.
+type Grader struct {
+	replacer *strings.Replacer
+}
+
+// New returns a Grader for the language with the given ISO 639-1 code.
+func New(lang string) Grader {
+	l := Languages[lang]
+	pairs := append([]string{}, l.Replace...)
+	for i := 0; i < len(foldings); i += 2 {
+		for _, r := range foldings[i+1] {
+			if !strings.ContainsRune(l.Keep, r) {
+				pairs = append(pairs, string(r), foldings[i])
+			}
+		}
+	}
+	return Grader{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Norm normalizes a phrase for comparison.
+// It removes parts in parentheses, case and all characters that are no letters or numbers.
+func Norm(s string) string {
+	s = inParantheses.ReplaceAllString(s, "")
+	s = strings.TrimSpace(s)
+	s = strings.ToLower(s)
+	return specialChars.ReplaceAllString(s, "")
+}
+
+// Grade compares an answer with the expected phrase.
+// For close answers a hint is returned.
+// The hint is the expected phrase with the parts the answer got wrong in brackets.
+func (g Grader) Grade(answer, expected string) (Result, string) {
+	a := Norm(answer)
+	e := Norm(expected)
+	if a == e {
+		return Exact, ""
+	}
+	fa := g.replacer.Replace(a)
+	fe := g.replacer.Replace(e)
+	if fa != fe && distance(fa, fe) > maxDistance(utf8.RuneCountInString(fe)) {
+		return Wrong, ""
+	}
+	return Close, hint(answer, expected)
+}
+
+// GradeAny compares an answer with all accepted phrases
+// and returns the best result.
+// The hint is for the phrase the answer is closest to.
+func (g Grader) GradeAny(answer string, accepted ...string) (Result, string) {
+	best := Wrong
+	bestHint := ""
+	for _, phrase := range accepted {
+		result, hint := g.Grade(answer, phrase)
+		if result > best {
+			best, bestHint = result, hint
+		}
+	}
+	return best, bestHint
+}
+
+// Number of typos tolerated in a phrase of length n.
+func maxDistance(n int) int {
+	return n / 5
+}
+
+// Levenshtein distance of two strings
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// Mark all parts of expected in brackets that are missing or different in answer.
+// Case and parts in parentheses are ignored.
+func hint(answer, expected string) string {
+	expected = strings.TrimSpace(inParantheses.ReplaceAllString(expected, ""))
+	ra := toLower([]rune(strings.TrimSpace(answer)))
+	re := []rune(expected)
+	le := toLower([]rune(expected))
+
+	// Edit distance matrix
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(le)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(le); j++ {
+			cost := 1
+			if ra[i-1] == le[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+		}
+	}
+
+	// Walk back to find the letters of expected that don't match
+	marked := make([]bool, len(le))
+	i, j := len(ra), len(le)
+	for j > 0 {
+		switch {
+		case i > 0 && ra[i-1] == le[j-1] && d[i][j] == d[i-1][j-1]:
+			i, j = i-1, j-1
+		case i > 0 && d[i][j] == d[i-1][j-1]+1:
+			marked[j-1] = true
+			i, j = i-1, j-1
+		case d[i][j] == d[i][j-1]+1:
+			marked[j-1] = true
+			j--
+		default:
+			i--
+		}
+	}
+
+	s := ""
+	for j, r := range re {
+		if marked[j] && (j == 0 || !marked[j-1]) {
+			s += "["
+		}
+		s += string(r)
+		if marked[j] && (j == len(re)-1 || !marked[j+1]) {
+			s += "]"
+		}
+	}
+	return s
+}
+
+func toLower(runes []rune) []rune {
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,82 @@
+package grade
+
+import "testing"
+
+func TestGrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     string
+		answer   string
+		expected string
+		result   Result
+		hint     string
+	}{
+		{"exact", "", "hola", "hola", Exact, ""},
+		{"case and punctuation", "", "Hola!", "¡hola!", Exact, ""},
+		{"parentheses", "", "la casa", "la casa (the house)", Exact, ""},
+		{"missing diacritic", "", "manana", "mañana", Close, "ma[ñ]ana"},
+		{"missing diacritic folded in spanish", "es", "cafe", "café", Close, "caf[é]"},
+		// In Spanish ñ is a letter of its own and a different letter is a typo
+		{"kept letter in long word", "es", "manana", "mañana", Close, "ma[ñ]ana"},
+		{"kept letter in short word", "es", "nino", "niño", Wrong, ""},
+		{"folded letter in short word", "", "nino", "niño", Close, "ni[ñ]o"},
+		{"kept dotless i", "tr", "kiz", "kız", Wrong, ""},
+		{"replaced sharp s", "de", "strasse", "straße", Close, "stra[ß]e"},
+		{"replaced umlaut", "de", "schoen", "schön", Close, "sch[ö]n"},
+		{"typo in short word", "", "gsto", "gato", Wrong, ""},
+		{"typo in long word", "", "bibloteca", "biblioteca", Close, "bibl[i]oteca"},
+		{"two typos in long word", "", "bibloteka", "biblioteca", Close, "bibl[i]ote[c]a"},
+		{"too many typos in long word", "", "bivlotrca", "biblioteca", Wrong, ""},
+		{"different word", "", "perro", "gato", Wrong, ""},
+		{"hint ignores parentheses", "", "la csa", "la casa (the house)", Close, "la c[a]sa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, hint := New(tt.lang).Grade(tt.answer, tt.expected)
+			if result != tt.result {
+				t.Errorf("expected result %d, got %d", tt.result, result)
+			}
+			if hint != tt.hint {
+				t.Errorf("expected hint '%s', got '%s'", tt.hint, hint)
+			}
+		})
+	}
+}
+
+func TestGradeAny(t *testing.T) {
+	tests := []struct {
+		answer   string
+		accepted []string
+		result   Result
+		hint     string
+	}{
+		{"coche", []string{"carro", "coche"}, Exact, ""},
+		{"cohe", []string{"carro", "coche"}, Close, "co[c]he"},
+		{"auto", []string{"carro", "coche"}, Wrong, ""},
+		{"auto", nil, Wrong, ""},
+	}
+	g := New("es")
+	for _, tt := range tests {
+		result, hint := g.GradeAny(tt.answer, tt.accepted...)
+		if result != tt.result || hint != tt.hint {
+			t.Errorf("expected %d '%s' for '%s' in %v, got %d '%s'", tt.result, tt.hint, tt.answer, tt.accepted, result, hint)
+		}
+	}
+}
+
+func TestNorm(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"Hola", "hola"},
+		{" ¿Qué tal? ", "quétal"},
+		{"el perro (dog)", "elperro"},
+		{"C'est-à-dire", "cestàdire"},
+		{"123", "123"},
+	}
+	for _, tt := range tests {
+		if out := Norm(tt.in); out != tt.out {
+			t.Errorf("expected '%s' for '%s', got '%s'", tt.out, tt.in, out)
+		}
+	}
+}
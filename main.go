@@ -4,24 +4,31 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jorinvo/studybot/admin"
+	"github.com/jorinvo/studybot/anki"
 	"github.com/jorinvo/studybot/brain"
 	"github.com/jorinvo/studybot/messenger"
 )
 
 const cliUsage = `Studybot - Facebook Messenger bot
 
-Usage: %s [flags]
+Usage: %[1]s [flags]
+       %[1]s import-anki [flags] file.apkg
 
 Studybot uses BoltDB as a database.
 Data is stored in a single file. No external system is needed.
 However, only one application can access the database at a time.
+On startup the database is migrated to the latest schema version.
+A backup of the file is written before any migration.
 
 Studybot starts a server to serve a webhook handler that can be registered as a Messenger bot.
 The server is HTTP only and a proxy server should be used to make the bot available on
@@ -35,6 +42,9 @@ Further, it provides an endpoint that can be registered as Slack Outgoing Webhoo
 When users send feedback to the bot, the messages are forwarded to Slack
 and admin replies in Slack are send back to the users.
 
+The subcommand import-anki adds the notes of an Anki package to the current deck of a chat.
+Run it while the bot is stopped since only one application can access the database at a time.
+
 
 Flags:
 `
@@ -43,6 +53,13 @@ func main() {
 	errorLogger := log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile|log.LUTC)
 	infoLogger := log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lshortfile|log.LUTC)
 
+	if len(os.Args) > 1 && os.Args[1] == "import-anki" {
+		if err := importAnki(os.Args[2:], infoLogger, errorLogger); err != nil {
+			errorLogger.Fatalln(err)
+		}
+		return
+	}
+
 	db := flag.String("db", "", "Required. Path to BoltDB file. Will be created if non-existent.")
 	port := flag.Int("port", 8080, "Port Facebook webhook listens on.")
 	verifyToken := flag.String("verify", "", "Required. Messenger bot verify token.")
@@ -50,6 +67,12 @@ func main() {
 	slackHook := flag.String("slackhook", "", "Required. URL of Slack Incoming Webhook. Used to send user messages to admin.")
 	slackToken := flag.String("slacktoken", "", "Token for Slack Outgoing Webhook. Used to send admin answers to user messages.")
 	adminPort := flag.Int("admin", 8081, "Port admin interface listens on.")
+	lang := flag.String("lang", "", "ISO 639-1 code of the studied language. Used to decide which typos and missing diacritics are tolerated in answers.")
+	schedulerName := flag.String("scheduler", "exponential", "Algorithm to schedule studies. One of 'exponential', 'sm2' or 'fsrs'.")
+	migrateOnly := flag.Bool("migrate-only", false, "Update the database to the latest schema version and exit.")
+	dryRun := flag.Bool("dry-run", false, "Report the migrations -migrate-only would run without changing the database. The database must exist.")
+	leeches := flag.Int("leech", 8, "Number of times a phrase can be forgotten before it is suspended. 0 never suspends phrases.")
+	steps := flag.String("steps", "", "Comma-separated delays of the learning steps new and forgotten phrases are studied again in before they are scheduled, like 1m,10m. No learning steps are used by default.")
 
 	// Parse and validate flags
 	flag.Usage = func() {
@@ -62,6 +85,25 @@ func main() {
 		errorLogger.Println("Flag -db is required.")
 		os.Exit(1)
 	}
+	if *migrateOnly || *dryRun {
+		open := brain.New
+		if *dryRun {
+			// Don't create the database or its buckets
+			open = brain.Open
+		}
+		store, err := open(*db)
+		if err != nil {
+			errorLogger.Fatalln("failed to open store:", err)
+		}
+		err = migrate(store, *dryRun, infoLogger)
+		if closeErr := store.Close(); closeErr != nil {
+			errorLogger.Println(closeErr)
+		}
+		if err != nil {
+			errorLogger.Fatalln(err)
+		}
+		return
+	}
 	if *token == "" {
 		errorLogger.Println("Flag -token is required.")
 		os.Exit(1)
@@ -74,9 +116,24 @@ func main() {
 		errorLogger.Println("Flag -slackhook is required.")
 		os.Exit(1)
 	}
+	scheduler, ok := brain.Schedulers[*schedulerName]
+	if !ok {
+		errorLogger.Printf("Flag -scheduler has unknown value '%s'.", *schedulerName)
+		os.Exit(1)
+	}
+
+	if *leeches < 0 {
+		errorLogger.Println("Flag -leech must not be negative.")
+		os.Exit(1)
+	}
+	learningSteps, err := parseSteps(*steps)
+	if err != nil {
+		errorLogger.Printf("Flag -steps is invalid: %v", err)
+		os.Exit(1)
+	}
 
 	// Setup database
-	store, err := brain.New(*db)
+	store, err := brain.New(*db, brain.UseScheduler(scheduler), brain.LeechThreshold(*leeches), brain.LearningSteps(learningSteps...))
 	if err != nil {
 		errorLogger.Fatalln("failed to create store:", err)
 	}
@@ -86,7 +143,11 @@ func main() {
 			errorLogger.Println(err)
 		}
 	}()
+	if err := migrate(store, false, infoLogger); err != nil {
+		errorLogger.Fatalln(err)
+	}
 	infoLogger.Printf("Database initialized: %s", *db)
+	infoLogger.Printf("Scheduling studies with %s", *schedulerName)
 
 	// Listen to system events for graceful shutdown
 	shutdownSignals := make(chan os.Signal, 1)
@@ -101,6 +162,7 @@ func main() {
 		messenger.LogInfo(infoLogger),
 		messenger.LogErr(errorLogger),
 		messenger.GetFeedback(feedback),
+		messenger.Language(*lang),
 		messenger.Setup,
 		messenger.Notify,
 	)
@@ -149,3 +211,128 @@ func main() {
 	}
 	infoLogger.Println("Server gracefully stopped.")
 }
+
+// Parse a comma-separated list of durations like "1m,10m".
+func parseSteps(s string) ([]time.Duration, error) {
+	var steps []time.Duration
+	if strings.TrimSpace(s) == "" {
+		return steps, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("step '%s' is not positive", field)
+		}
+		steps = append(steps, d)
+	}
+	return steps, nil
+}
+
+// Update the database to the latest schema version and log what has been done.
+func migrate(store *brain.Bolt, dryRun bool, infoLogger *log.Logger) error {
+	version, latest, err := store.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	done, err := store.Migrate(dryRun)
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		infoLogger.Printf("Database schema is up to date at version %d", version)
+		return nil
+	}
+	action := "Migrated"
+	if dryRun {
+		action = "Dry run, would migrate"
+	}
+	infoLogger.Printf("%s database schema from version %d to %d:", action, version, latest)
+	for _, d := range done {
+		infoLogger.Printf("  %s", d)
+	}
+	return nil
+}
+
+const importAnkiUsage = `Import the notes of an Anki package (.apkg) to the current deck of a chat.
+
+Usage: %s import-anki [flags] file.apkg
+
+Flags:
+`
+
+// Run the import-anki subcommand and log a summary of the import.
+func importAnki(args []string, infoLogger, errorLogger *log.Logger) error {
+	flags := flag.NewFlagSet("import-anki", flag.ExitOnError)
+	db := flags.String("db", "", "Required. Path to BoltDB file.")
+	chatID := flags.Int64("chatid", 0, "Required. ID of the chat to add the phrases to.")
+	fieldMapping := flags.String("fields", "", "Note fields used for phrases like 'phrase=Back,explanation=Front' (default).")
+	keepSchedule := flags.Bool("schedule", false, "Keep the intervals of cards Anki reviews. Otherwise phrases are studied like new ones.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, importAnkiUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *db == "" || *chatID == 0 || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	fields, err := anki.ParseFields(*fieldMapping)
+	if err != nil {
+		return err
+	}
+	options := []func(*anki.Options){anki.MapFields(fields)}
+	if *keepSchedule {
+		options = append(options, anki.KeepSchedule)
+	}
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	notes, err := anki.Read(data, options...)
+	if err != nil {
+		return err
+	}
+
+	store, err := brain.New(*db)
+	if err != nil {
+		return fmt.Errorf("failed to create store: %v", err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			errorLogger.Println(err)
+		}
+	}()
+	if err := migrate(store, false, infoLogger); err != nil {
+		return err
+	}
+	var phrases []brain.Phrase
+	var ids []int64
+	for _, n := range notes {
+		if n.Err != nil {
+			infoLogger.Printf("Failed note %d: %v", n.ID, n.Err)
+			continue
+		}
+		phrases = append(phrases, n.Phrase)
+		ids = append(ids, n.ID)
+	}
+	added, err := store.ImportPhrases(*chatID, phrases)
+	if err != nil {
+		return err
+	}
+	imported := 0
+	for i, id := range added {
+		if id == 0 {
+			infoLogger.Printf("Skipped note %d: explanation already exists: %s", ids[i], phrases[i].Explanation)
+			continue
+		}
+		imported++
+	}
+	infoLogger.Printf("Imported %d of %d notes", imported, len(notes))
+	return nil
+}
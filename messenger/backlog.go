@@ -0,0 +1,24 @@
+package messenger
+
+import (
+	"fmt"
+	"time"
+)
+
+// Spread overdue studies over the next days if there are too many
+// and tell the user about it.
+func (b Bot) spreadBacklog(id int64) {
+	backlog, err := b.store.SpreadBacklog(id, time.Now())
+	if err != nil {
+		b.err.Println(err)
+		return
+	}
+	if backlog.Days == 0 {
+		return
+	}
+	days := "day"
+	if backlog.Days > 1 {
+		days = fmt.Sprintf("%d days", backlog.Days)
+	}
+	b.send(id, fmt.Sprintf(messageBacklog, backlog.Overdue, backlog.Today, days), nil, nil)
+}
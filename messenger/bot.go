@@ -3,21 +3,14 @@ package messenger
 import (
 	"fmt"
 	"math"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/jorinvo/studybot/brain"
 	"github.com/jorinvo/studybot/fbot"
+	"github.com/jorinvo/studybot/grade"
 )
 
-// Everything that is not in the unicode character classes
-// for letters or numeric values
-// See: http://www.fileformat.info/info/unicode/category/index.htm
-var specialChars = regexp.MustCompile(`[^\p{Ll}\p{Lm}\p{Lo}\p{Lu}\p{Nd}\p{Nl}\p{No}]`)
-
-var inParantheses = regexp.MustCompile(`\(.*?\)`)
-
 // HandleEvent handles a Messenger event.
 func (b Bot) HandleEvent(e fbot.Event) {
 	if e.Type == fbot.EventError {
@@ -54,15 +47,14 @@ func (b Bot) handleMessage(id int64, msg string) {
 		return
 	}
 	switch mode {
-	case brain.ModeStudy:
+	case brain.ModeStudy, brain.ModeQuiz:
 		study, err := b.store.GetStudy(id)
 		if err != nil {
 			b.send(id, messageErr, buttonsStudyMode, fmt.Errorf("failed to get study: %v", err))
 			return
 		}
 		// Score user unput and pick appropriate reply
-		msgNormalized := normPhrase(msg)
-		if msgNormalized == "" {
+		if grade.Norm(msg) == "" {
 			study, err := b.store.GetStudy(id)
 			if err != nil {
 				b.send(id, messageErr, buttonsShow, fmt.Errorf("failed to get study: %v", err))
@@ -71,27 +63,38 @@ func (b Bot) handleMessage(id int64, msg string) {
 			b.send(id, study.Phrase, buttonsScore, nil)
 			return
 		}
-		var score = 1
-		reply := messageStudyCorrect
-		if msgNormalized != normPhrase(study.Phrase) {
+		settings, err := b.store.GetUserSettings(id)
+		if err != nil {
+			b.send(id, messageErr, buttonsStudyMode, err)
+			return
+		}
+		var score int
+		var reply string
+		accepted := append([]string{study.Phrase}, study.Alternatives...)
+		switch result, hint := b.grader.GradeAny(msg, accepted...); result {
+		case grade.Exact:
+			score = 1
+			reply = messageStudyCorrect
+		case grade.Close:
+			score = closeScore(settings.Strictness)
+			reply = fmt.Sprintf(messageStudyClose, hint)
+		default:
 			score = -1
 			reply = fmt.Sprintf(messageStudyWrong, study.Phrase)
 		}
 		b.send(id, reply, nil, nil)
-		b.send(b.scoreAndStudy(id, score))
+		b.send(b.scoreAndStudy(id, score, true))
 
 	case brain.ModeAdd:
-		parts := strings.SplitN(strings.TrimSpace(msg), "\n", 2)
-		phrase := strings.TrimSpace(parts[0])
-		if phrase == "" {
-			b.send(id, messagePhraseEmpty, buttonsAddMode, nil)
+		if text, explanation := parseCloze(msg); brain.IsCloze(text) {
+			b.addCloze(id, text, explanation)
 			return
 		}
-		if len(parts) == 1 {
-			b.send(id, messageExplanationEmpty, buttonsAddMode, nil)
+		phrase, alternatives, explanation, reply := parsePhrase(msg)
+		if reply != "" {
+			b.send(id, reply, buttonsAddMode, nil)
 			return
 		}
-		explanation := strings.TrimSpace(parts[1])
 		// Check for existing explanation
 		p, err := b.store.FindPhrase(id, func(p brain.Phrase) bool {
 			return p.Explanation == explanation
@@ -105,12 +108,19 @@ func (b Bot) handleMessage(id int64, msg string) {
 			return
 		}
 		// Save phrase
-		if err = b.store.AddPhrase(id, phrase, explanation); err != nil {
+		phraseID, err := b.store.AddPhrase(id, phrase, explanation, alternatives...)
+		if err != nil {
 			b.send(id, messageErr, buttonsAddMode, fmt.Errorf("failed to save phrase: %v", err))
 			return
 		}
-		b.send(id, fmt.Sprintf(messageAddDone, phrase, explanation), nil, nil)
-		b.send(id, messageAddNext, buttonsAddMode, nil)
+		b.send(id, fmt.Sprintf(messageAddDone, joinAlternatives(phrase, alternatives), explanation), nil, nil)
+		b.send(id, messageAddNext, b.buttonsAddNext(id, phraseID), nil)
+
+	case brain.ModeEditPhrase, brain.ModeEditLeech:
+		b.handleEdit(id, mode, msg)
+
+	case brain.ModeAddDeck, brain.ModeRenameDeck:
+		b.handleDeckName(id, mode, msg)
 
 	case brain.ModeGetStarted:
 		b.messageWelcome(id)
@@ -136,6 +146,51 @@ func (b Bot) handleMessage(id int64, msg string) {
 }
 
 func (b Bot) handlePayload(id int64, payload string) {
+	if strings.HasPrefix(payload, payloadSelectDeck) {
+		b.send(b.selectDeck(id, payload))
+		return
+	}
+	if strings.HasPrefix(payload, payloadDeckDirection) {
+		b.send(b.setDeckDirection(id, payload))
+		return
+	}
+	if strings.HasPrefix(payload, payloadPhraseDirection) {
+		b.send(b.setPhraseDirection(id, payload))
+		return
+	}
+	if strings.HasPrefix(payload, payloadQuiz) {
+		b.answerQuiz(id, payload)
+		return
+	}
+	if strings.HasPrefix(payload, payloadLeechKeep) {
+		b.keepLeech(id, payload)
+		return
+	}
+	if strings.HasPrefix(payload, payloadLeechReset) {
+		b.resetLeech(id, payload)
+		return
+	}
+	if strings.HasPrefix(payload, payloadLeechEdit) {
+		b.send(b.startEditLeech(id, payload))
+		return
+	}
+	if strings.HasPrefix(payload, payloadUnsuspend) {
+		b.send(b.unsuspend(id, payload))
+		return
+	}
+	if strings.HasPrefix(payload, payloadShowSetting) {
+		b.send(b.messageSetting(id, payload))
+		return
+	}
+	if strings.HasPrefix(payload, payloadSetting) {
+		b.send(b.setSetting(id, payload))
+		return
+	}
+	if strings.HasPrefix(payload, payloadExport) {
+		b.send(b.sendExport(id, payload))
+		return
+	}
+
 	switch payload {
 	case payloadGetStarted:
 		b.messageWelcome(id)
@@ -148,6 +203,17 @@ func (b Bot) handlePayload(id int64, payload string) {
 			b.send(id, messageErr, buttonsMenuMode, err)
 			return
 		}
+		b.resumeIfPaused(id)
+		b.spreadBacklog(id)
+		b.send(b.startStudy(id))
+
+	case payloadStartQuiz:
+		if err := b.store.SetMode(id, brain.ModeQuiz); err != nil {
+			b.send(id, messageErr, buttonsMenuMode, err)
+			return
+		}
+		b.resumeIfPaused(id)
+		b.spreadBacklog(id)
 		b.send(b.startStudy(id))
 
 	case payloadStartAdd:
@@ -155,7 +221,18 @@ func (b Bot) handlePayload(id int64, payload string) {
 			b.send(id, messageErr, buttonsMenuMode, err)
 			return
 		}
-		b.send(id, messageStartAdd, buttonsAddMode, nil)
+		msg := messageStartAdd
+		// Only mention decks to users who use them
+		if decks, err := b.store.GetDecks(id); err != nil {
+			b.err.Println(err)
+		} else if len(decks) > 1 {
+			if deck, err := b.currentDeck(id); err != nil {
+				b.err.Println(err)
+			} else {
+				msg += "\n\n" + fmt.Sprintf(messageStartAddDeck, deck.Name)
+			}
+		}
+		b.send(id, msg, buttonsAddMode, nil)
 
 	case payloadShowHelp:
 		isSubscribed, err := b.store.IsSubscribed(id)
@@ -166,7 +243,15 @@ func (b Bot) handlePayload(id int64, payload string) {
 		if !isSubscribed {
 			buttons = buttons[1:]
 		}
-		b.send(id, messageHelp, buttons, nil)
+		since, err := b.store.PausedSince(id)
+		if err != nil {
+			b.err.Println(err)
+		}
+		pause := buttonPause
+		if !since.IsZero() {
+			pause = buttonResume
+		}
+		b.send(id, messageHelp, append([]fbot.Button{pause}, buttons...), nil)
 
 	case payloadShowStudy:
 		study, err := b.store.GetStudy(id)
@@ -177,13 +262,13 @@ func (b Bot) handlePayload(id int64, payload string) {
 		b.send(id, study.Phrase, buttonsScore, nil)
 
 	case payloadScoreBad:
-		b.send(b.scoreAndStudy(id, -1))
+		b.send(b.scoreAndStudy(id, -1, false))
 
 	case payloadScoreOk:
-		b.send(b.scoreAndStudy(id, 0))
+		b.send(b.scoreAndStudy(id, 0, false))
 
 	case payloadScoreGood:
-		b.send(b.scoreAndStudy(id, 1))
+		b.send(b.scoreAndStudy(id, 1, false))
 
 	case payloadDelete:
 		b.send(id, messageConfirmDelete, buttonsConfirmDelete, nil)
@@ -196,6 +281,53 @@ func (b Bot) handlePayload(id int64, payload string) {
 		}
 		b.send(b.startStudy(id))
 
+	case payloadEdit:
+		b.send(b.startEdit(id))
+
+	case payloadContinueStudy:
+		b.send(b.startStudy(id))
+
+	case payloadShowSuspended:
+		b.send(b.messageSuspended(id))
+
+	case payloadUndo:
+		b.send(b.undoStudy(id))
+
+	case payloadShowSettings:
+		b.send(b.messageSettings(id))
+
+	case payloadShowExport:
+		b.send(b.messageExport(id))
+
+	case payloadPause:
+		b.send(b.pause(id))
+
+	case payloadResume:
+		b.send(b.resume(id))
+
+	case payloadDeleteData:
+		b.send(id, messageDeleteData, buttonsDeleteData, nil)
+
+	case payloadConfirmDeleteData:
+		b.send(id, messageConfirmDeleteData, buttonsConfirmDeleteData, nil)
+
+	case payloadDeleteDataNow:
+		b.stopNotify(id)
+		if err := b.store.DeleteChat(id); err != nil {
+			b.send(id, messageErr, buttonsMenuMode, err)
+			return
+		}
+		b.info.Printf("Deleted all data of %d", id)
+		b.send(id, messageDataDeleted, nil, nil)
+
+	case payloadCancelEdit:
+		if err := b.store.SetMode(id, brain.ModeStudy); err != nil {
+			b.send(id, messageErr, buttonsStudyMode, err)
+			return
+		}
+		b.send(id, messageCancelEdit, nil, nil)
+		b.send(b.startStudy(id))
+
 	case payloadCancelDelete:
 		b.send(id, messageCancelDelete, nil, nil)
 		b.send(b.startStudy(id))
@@ -224,6 +356,38 @@ func (b Bot) handlePayload(id int64, payload string) {
 		}
 		b.send(id, messageFedback, buttonsFeedback, nil)
 
+	case payloadShowStats:
+		b.send(b.messageStats(id))
+
+	case payloadShowDecks:
+		if err := b.store.SetMode(id, brain.ModeMenu); err != nil {
+			b.send(id, messageErr, buttonsMenuMode, err)
+			return
+		}
+		b.send(b.messageDecks(id))
+
+	case payloadStudyAllDecks:
+		b.send(b.studyAllDecks(id))
+
+	case payloadAddDeck:
+		if err := b.store.SetMode(id, brain.ModeAddDeck); err != nil {
+			b.send(id, messageErr, buttonsMenuMode, err)
+			return
+		}
+		b.send(id, messageAddDeck, buttonsDeckName, nil)
+
+	case payloadRenameDeck:
+		b.send(b.startRenameDeck(id))
+
+	case payloadDeleteDeck:
+		b.send(b.deleteDeck(id))
+
+	case payloadConfirmDeleteDeck:
+		b.send(b.confirmDeleteDeck(id))
+
+	case payloadShowDeckDirection:
+		b.send(b.messageDeckDirection(id))
+
 	case payloadStartMenu:
 		fallthrough
 	default:
@@ -231,6 +395,129 @@ func (b Bot) handlePayload(id int64, payload string) {
 	}
 }
 
+func (b Bot) startEdit(id int64) (int64, string, []fbot.Button, error) {
+	study, err := b.store.GetStudy(id)
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	if study.Total == 0 {
+		return b.startStudy(id)
+	}
+	p, err := b.store.GetPhrase(id, study.PhraseID)
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	if err := b.store.SetMode(id, brain.ModeEditPhrase); err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	msg := fmt.Sprintf(messageStartEdit, joinAlternatives(p.Phrase, p.Alternatives), p.Explanation)
+	return id, msg, buttonsEditMode, nil
+}
+
+// Update the phrase currently studied or the phrase that has just been suspended
+// and continue studying.
+func (b Bot) handleEdit(id int64, mode brain.Mode, msg string) {
+	phraseID, ok, err := b.editTarget(id, mode)
+	if err != nil {
+		b.send(id, messageErr, buttonsEditMode, err)
+		return
+	}
+	if !ok {
+		b.send(b.startStudy(id))
+		return
+	}
+	current, err := b.store.GetPhrase(id, phraseID)
+	if err != nil {
+		b.send(id, messageErr, buttonsEditMode, err)
+		return
+	}
+	if current.Cloze {
+		b.editCloze(id, mode, phraseID, msg)
+		return
+	}
+	phrase, alternatives, explanation, reply := parsePhrase(msg)
+	if reply != "" {
+		b.send(id, reply, buttonsEditMode, nil)
+		return
+	}
+	// Check for existing explanation if it changed
+	if explanation != current.Explanation {
+		p, err := b.store.FindPhrase(id, func(p brain.Phrase) bool {
+			return p.Explanation == explanation
+		})
+		if err != nil {
+			b.send(id, messageErr, buttonsEditMode, fmt.Errorf("failed to lookup phrase: %v", err))
+			return
+		}
+		if p.Phrase != "" {
+			b.send(id, fmt.Sprintf(messageExplanationExists, p.Phrase, p.Explanation), buttonsEditMode, nil)
+			return
+		}
+	}
+	if err := b.store.UpdatePhrase(id, phraseID, phrase, explanation, alternatives...); err != nil {
+		b.send(id, messageErr, buttonsEditMode, fmt.Errorf("failed to update phrase: %v", err))
+		return
+	}
+	if err := b.doneEditing(id, mode, phraseID); err != nil {
+		b.send(id, messageErr, buttonsStudyMode, err)
+		return
+	}
+	b.send(id, fmt.Sprintf(messageAddDone, joinAlternatives(phrase, alternatives), explanation), nil, nil)
+	b.send(b.startStudy(id))
+}
+
+// Get the ID of the phrase to edit.
+// A suspended phrase is stored together with the mode when editing starts.
+// Returns false if there is no phrase to edit anymore.
+func (b Bot) editTarget(id int64, mode brain.Mode) (int64, bool, error) {
+	if mode == brain.ModeEditLeech {
+		phraseID, err := b.store.GetModePhrase(id)
+		if err != nil {
+			return 0, false, err
+		}
+		return phraseID, phraseID != 0, nil
+	}
+	study, err := b.store.GetStudy(id)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get study: %v", err)
+	}
+	return study.PhraseID, study.Total > 0, nil
+}
+
+// Go back to studying after a phrase has been edited.
+// Suspended phrases are studied again from scratch after being corrected.
+func (b Bot) doneEditing(id int64, mode brain.Mode, phraseID int64) error {
+	if mode == brain.ModeEditLeech {
+		if err := b.store.ResetPhrase(id, phraseID); err != nil {
+			return err
+		}
+	}
+	return b.store.SetMode(id, brain.ModeStudy)
+}
+
+// Revert the latest study and ask it again.
+func (b Bot) undoStudy(id int64) (int64, string, []fbot.Button, error) {
+	undone, err := b.store.UndoStudy(id)
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	if !undone {
+		return id, messageUndoNothing, buttonsMenuMode, nil
+	}
+	// Continue studying since the user might have left already
+	mode, err := b.store.GetMode(id)
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	if mode != brain.ModeQuiz {
+		if err := b.store.SetMode(id, brain.ModeStudy); err != nil {
+			return id, messageErr, buttonsStudyMode, err
+		}
+	}
+	b.send(id, messageUndone, nil, nil)
+	return b.startStudy(id)
+}
+
 func (b Bot) messageStartMenu(id int64) (int64, string, []fbot.Button, error) {
 	if err := b.store.SetMode(id, brain.ModeMenu); err != nil {
 		return id, messageErr, buttonsMenuMode, err
@@ -244,6 +531,8 @@ func (b Bot) messageWelcome(id int64) {
 	if err != nil {
 		name = "there"
 		b.err.Printf("failed to get profile for %d: %v", id, err)
+	} else {
+		b.updateTimezone(id, p)
 	}
 	b.send(id, fmt.Sprintf(messageWelcome, name), nil, nil)
 	time.Sleep(6 * time.Second)
@@ -278,15 +567,80 @@ func (b Bot) startStudy(id int64) (int64, string, []fbot.Button, error) {
 		return id, msg + messageAskToSubscribe, buttonsSubscribe, nil
 	}
 	// Send study to user
-	return id, fmt.Sprintf(messageStudyQuestion, study.Total, study.Explanation), buttonsShow, nil
+	b.asked.set(id, time.Now())
+	question := messageStudyQuestion
+	if study.Reverse {
+		question = messageStudyQuestionReverse
+	}
+	if study.Cloze {
+		question = messageStudyQuestionCloze
+	}
+	question = fmt.Sprintf(question, study.Total, study.Explanation)
+	mode, err := b.store.GetMode(id)
+	if err != nil {
+		return id, question, buttonsShow, err
+	}
+	if mode == brain.ModeQuiz {
+		// Fall back to a normal study if there are not enough phrases for a quiz
+		quiz, buttons, ok, err := b.quizQuestion(id, study, question)
+		if ok {
+			return id, quiz, buttons, err
+		}
+		if err != nil {
+			b.err.Println(err)
+		}
+	}
+	return id, question, buttonsShow, nil
 }
 
-func (b Bot) scoreAndStudy(id int64, score int) (int64, string, []fbot.Button, error) {
-	err := b.store.ScoreStudy(id, score)
+func (b Bot) messageStats(id int64) (int64, string, []fbot.Button, error) {
+	// Use the timezone of the user to count days
+	now := time.Now()
+	p, err := b.client.GetProfile(id)
+	if err != nil {
+		b.err.Printf("failed to get profile for %d: %v", id, err)
+	} else {
+		now = now.In(time.FixedZone("", int(p.Timezone*60*60)))
+		b.updateTimezone(id, p)
+	}
+	s, err := b.store.GetStats(id, now)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	forecast := make([]string, len(s.Forecast))
+	for i, count := range s.Forecast {
+		forecast[i] = fmt.Sprintf("%s %d", now.AddDate(0, 0, i).Format("Mon"), count)
+	}
+	msg := fmt.Sprintf(messageStats,
+		s.Total, s.New, s.Learning, s.Mature,
+		s.ReviewsToday,
+		formatRetention(s.Retention7, s.Reviews7),
+		formatRetention(s.Retention30, s.Reviews30),
+		s.Streak,
+		strings.Join(forecast, " \u00B7 "),
+	)
+	return id, msg, buttonsMenuMode, nil
+}
+
+func (b Bot) scoreAndStudy(id int64, score int, typed bool) (int64, string, []fbot.Button, error) {
+	// Remember the study in case it gets suspended
+	study, err := b.store.GetStudy(id)
 	if err != nil {
 		return id, messageErr, buttonsStudyMode, err
 	}
-	return b.startStudy(id)
+	suspended, err := b.store.ScoreStudy(id, score, brain.Answer{Typed: typed, Latency: b.asked.since(id)})
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	var msg string
+	var buttons []fbot.Button
+	if suspended {
+		id, msg, buttons, err = b.messageLeech(id, study.PhraseID)
+	} else {
+		id, msg, buttons, err = b.startStudy(id)
+	}
+	// Allow to undo the study in case of a mis-tap
+	return id, msg, append(append([]fbot.Button{}, buttons...), buttonUndo), err
 }
 
 // Send replies and log errors
@@ -322,9 +676,38 @@ func formatDuration(d time.Duration) string {
 	}
 	return s
 }
-func normPhrase(s string) string {
-	s = inParantheses.ReplaceAllString(s, "")
-	s = strings.TrimSpace(s)
-	s = strings.ToLower(s)
-	return specialChars.ReplaceAllString(s, "")
+
+// Split a message into phrase, alternatives and explanation.
+// The first line contains the phrase and optional alternatives separated by brain.AlternativesSeparator.
+// The reply is set if the message is invalid.
+func parsePhrase(msg string) (phrase string, alternatives []string, explanation, reply string) {
+	parts := strings.SplitN(strings.TrimSpace(msg), "\n", 2)
+	versions := strings.Split(parts[0], brain.AlternativesSeparator)
+	phrase = strings.TrimSpace(versions[0])
+	if phrase == "" {
+		return "", nil, "", messagePhraseEmpty
+	}
+	if len(parts) == 1 {
+		return "", nil, "", messageExplanationEmpty
+	}
+	for _, v := range versions[1:] {
+		if v = strings.TrimSpace(v); v != "" {
+			alternatives = append(alternatives, v)
+		}
+	}
+	return phrase, alternatives, strings.TrimSpace(parts[1]), ""
+}
+
+// Format a phrase with its alternatives like they are sent by the user.
+func joinAlternatives(phrase string, alternatives []string) string {
+	return strings.Join(append([]string{phrase}, alternatives...), " "+brain.AlternativesSeparator+" ")
+}
+
+// Format like "80% of 25 studies".
+// Returns "-" if there are no studies.
+func formatRetention(retention float64, studies int) string {
+	if studies == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%% of %d studies", retention*100, studies)
 }
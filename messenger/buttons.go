@@ -17,12 +17,28 @@ var (
 	buttonDone   = fbot.Button{Text: "\u2714 done", Payload: payloadIdle}
 	buttonHelp   = fbot.Button{Text: "\u2753 help", Payload: payloadShowHelp}
 	buttonDelete = fbot.Button{Text: iconDelete, Payload: payloadDelete}
+	// Bar chart emoji
+	buttonStats = fbot.Button{Text: "\U0001F4CA stats", Payload: payloadShowStats}
+	// Pencil emoji
+	buttonEdit = fbot.Button{Text: "\u270F edit", Payload: payloadEdit}
+	// Card index dividers emoji
+	buttonDecks = fbot.Button{Text: "\U0001F5C2 decks", Payload: payloadShowDecks}
+	// Game die emoji
+	buttonQuiz = fbot.Button{Text: "\U0001F3B2 quiz", Payload: payloadStartQuiz}
+	// Anticlockwise arrows emoji
+	buttonUndo = fbot.Button{Text: "\U0001F504 undo", Payload: payloadUndo}
+	// Palm tree emoji
+	buttonPause  = fbot.Button{Text: "\U0001F334 pause studies", Payload: payloadPause}
+	buttonResume = fbot.Button{Text: "resume studies", Payload: payloadResume}
 )
 
 var (
 	buttonsMenuMode = []fbot.Button{
 		buttonStudy,
+		buttonQuiz,
 		buttonAdd,
+		buttonDecks,
+		buttonStats,
 		buttonHelp,
 		buttonDone,
 	}
@@ -32,7 +48,13 @@ var (
 	}
 	buttonsHelp = []fbot.Button{
 		fbot.Button{Text: "stop notifications", Payload: payloadUnsubscribe},
+		buttonStats,
+		fbot.Button{Text: "suspended phrases", Payload: payloadShowSuspended},
+		// Gear emoji
+		fbot.Button{Text: "\u2699 settings", Payload: payloadShowSettings},
+		fbot.Button{Text: "download phrases", Payload: payloadShowExport},
 		fbot.Button{Text: "send feedback", Payload: payloadFeedback},
+		fbot.Button{Text: "delete my data", Payload: payloadDeleteData},
 		fbot.Button{Text: "all good", Payload: payloadStartMenu},
 	}
 	buttonsFeedback = []fbot.Button{
@@ -41,16 +63,21 @@ var (
 	buttonsAddMode = []fbot.Button{
 		fbot.Button{Text: "stop adding", Payload: payloadStartMenu},
 	}
+	buttonsEditMode = []fbot.Button{
+		fbot.Button{Text: "cancel", Payload: payloadCancelEdit},
+	}
 	buttonsStudyMode = []fbot.Button{
 		buttonStudyDone,
 	}
 	buttonsShow = []fbot.Button{
 		buttonDelete,
+		buttonEdit,
 		buttonStudyDone,
 		fbot.Button{Text: "\U0001F449 show phrase", Payload: payloadShowStudy},
 	}
 	buttonsScore = []fbot.Button{
 		buttonDelete,
+		buttonEdit,
 		// Thumb down emoji
 		fbot.Button{Text: "\U0001F44E didn't know", Payload: payloadScoreBad},
 		// Thinking face emoji
@@ -65,8 +92,31 @@ var (
 		buttonStudy,
 		fbot.Button{Text: "not now", Payload: payloadStartMenu},
 	}
+	buttonsDecks = []fbot.Button{
+		fbot.Button{Text: "\u2795 new deck", Payload: payloadAddDeck},
+		fbot.Button{Text: "rename", Payload: payloadRenameDeck},
+		fbot.Button{Text: "direction", Payload: payloadShowDeckDirection},
+		fbot.Button{Text: iconDelete + " delete", Payload: payloadDeleteDeck},
+		fbot.Button{Text: "back", Payload: payloadStartMenu},
+	}
+	buttonsDeckName = []fbot.Button{
+		fbot.Button{Text: iconDelete + " cancel", Payload: payloadShowDecks},
+	}
+	buttonsConfirmDeleteDeck = []fbot.Button{
+		fbot.Button{Text: iconDelete + " delete deck", Payload: payloadConfirmDeleteDeck},
+		fbot.Button{Text: "cancel", Payload: payloadShowDecks},
+	}
 	buttonsConfirmDelete = []fbot.Button{
 		fbot.Button{Text: iconDelete + " delete phrase", Payload: payloadConfirmDelete},
 		fbot.Button{Text: "cancel", Payload: payloadCancelDelete},
 	}
+	buttonsDeleteData = []fbot.Button{
+		fbot.Button{Text: "delete everything", Payload: payloadConfirmDeleteData},
+		fbot.Button{Text: "download phrases", Payload: payloadShowExport},
+		fbot.Button{Text: "cancel", Payload: payloadStartMenu},
+	}
+	buttonsConfirmDeleteData = []fbot.Button{
+		fbot.Button{Text: iconDelete + " yes, delete", Payload: payloadDeleteDataNow},
+		fbot.Button{Text: "cancel", Payload: payloadStartMenu},
+	}
 )
@@ -0,0 +1,59 @@
+package messenger
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jorinvo/studybot/brain"
+)
+
+// Split a message into a text with cloze deletions and an optional explanation.
+func parseCloze(msg string) (text, explanation string) {
+	parts := strings.SplitN(strings.TrimSpace(msg), "\n", 2)
+	text = strings.TrimSpace(parts[0])
+	if len(parts) > 1 {
+		explanation = strings.TrimSpace(parts[1])
+	}
+	return text, explanation
+}
+
+func (b Bot) addCloze(id int64, text, explanation string) {
+	// Check for existing text
+	p, err := b.store.FindPhrase(id, func(p brain.Phrase) bool {
+		return p.Cloze && p.Phrase == text
+	})
+	if err != nil {
+		b.send(id, messageErr, nil, fmt.Errorf("failed to lookup phrase: %v", err))
+		return
+	}
+	if p.Phrase != "" {
+		b.send(id, messageClozeExists, buttonsAddMode, nil)
+		return
+	}
+	if _, err := b.store.AddCloze(id, text, explanation); err != nil {
+		b.send(id, messageErr, buttonsAddMode, fmt.Errorf("failed to save cloze: %v", err))
+		return
+	}
+	gaps := strings.Count(text, "{{")
+	b.send(id, fmt.Sprintf(messageAddClozeDone, gaps, text), nil, nil)
+	b.send(id, messageAddNext, buttonsAddMode, nil)
+}
+
+// Update a cloze phrase and continue studying it.
+func (b Bot) editCloze(id int64, mode brain.Mode, phraseID int64, msg string) {
+	text, explanation := parseCloze(msg)
+	if !brain.IsCloze(text) {
+		b.send(id, messageClozeEmpty, buttonsEditMode, nil)
+		return
+	}
+	if err := b.store.UpdatePhrase(id, phraseID, text, explanation); err != nil {
+		b.send(id, messageErr, buttonsEditMode, fmt.Errorf("failed to update cloze: %v", err))
+		return
+	}
+	if err := b.doneEditing(id, mode, phraseID); err != nil {
+		b.send(id, messageErr, buttonsStudyMode, err)
+		return
+	}
+	b.send(id, fmt.Sprintf(messageAddClozeDone, strings.Count(text, "{{"), text), nil, nil)
+	b.send(b.startStudy(id))
+}
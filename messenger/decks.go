@@ -0,0 +1,195 @@
+package messenger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/fbot"
+)
+
+const (
+	// Maximum number of quick replies Messenger displays
+	maxButtons = 11
+	// Maximum length of a quick reply title
+	maxButtonText = 20
+)
+
+// List all decks and offer to pick one.
+func (b Bot) messageDecks(id int64) (int64, string, []fbot.Button, error) {
+	decks, err := b.store.GetDecks(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	settings, err := b.store.GetDeckSettings(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+
+	var buttons []fbot.Button
+	if !settings.StudyAll {
+		buttons = append(buttons, fbot.Button{Text: "all decks", Payload: payloadStudyAllDecks})
+	}
+	var lines []string
+	current := ""
+	for _, d := range decks {
+		if d.ID == settings.Current {
+			current = d.Name
+			lines = append(lines, "\u2022 "+d.Name+" (current)")
+			if !settings.StudyAll {
+				continue
+			}
+		} else {
+			lines = append(lines, "\u2022 "+d.Name)
+		}
+		if len(buttons)+len(buttonsDecks) < maxButtons {
+			buttons = append(buttons, fbot.Button{
+				Text:    truncate(d.Name, maxButtonText),
+				Payload: payloadSelectDeck + strconv.FormatInt(d.ID, 10),
+			})
+		}
+	}
+	buttons = append(buttons, buttonsDecks...)
+
+	studying := messageDecksStudyCurrent
+	if settings.StudyAll {
+		studying = messageDecksStudyAll
+	}
+	msg := fmt.Sprintf(messageDecks, strings.Join(lines, "\n"), current, studying)
+	return id, msg, buttons, nil
+}
+
+// Make the deck of the payload the current one
+// and only study its phrases.
+func (b Bot) selectDeck(id int64, payload string) (int64, string, []fbot.Button, error) {
+	deckID, err := strconv.ParseInt(strings.TrimPrefix(payload, payloadSelectDeck), 10, 64)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, fmt.Errorf("failed to parse deck payload '%s': %v", payload, err)
+	}
+	deck, err := b.store.GetDeck(id, deckID)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	err = b.store.SetDeckSettings(id, brain.DeckSettings{Current: deck.ID, StudyAll: false})
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	return id, fmt.Sprintf(messageDeckSelected, deck.Name), buttonsMenuMode, nil
+}
+
+func (b Bot) studyAllDecks(id int64) (int64, string, []fbot.Button, error) {
+	settings, err := b.store.GetDeckSettings(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	settings.StudyAll = true
+	if err := b.store.SetDeckSettings(id, settings); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	return id, messageStudyAllDecks, buttonsMenuMode, nil
+}
+
+func (b Bot) startRenameDeck(id int64) (int64, string, []fbot.Button, error) {
+	deck, err := b.currentDeck(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	if err := b.store.SetMode(id, brain.ModeRenameDeck); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	return id, fmt.Sprintf(messageRenameDeck, deck.Name), buttonsDeckName, nil
+}
+
+func (b Bot) deleteDeck(id int64) (int64, string, []fbot.Button, error) {
+	deck, err := b.currentDeck(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	if deck.ID == brain.DefaultDeck {
+		return id, messageDeleteDefaultDeck, buttonsDecks, nil
+	}
+	return id, fmt.Sprintf(messageConfirmDeleteDeck, deck.Name), buttonsConfirmDeleteDeck, nil
+}
+
+func (b Bot) confirmDeleteDeck(id int64) (int64, string, []fbot.Button, error) {
+	settings, err := b.store.GetDeckSettings(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	if err := b.store.DeleteDeck(id, settings.Current); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	return id, messageDeckDeleted, buttonsMenuMode, nil
+}
+
+// Handle a deck name sent in ModeAddDeck or ModeRenameDeck.
+func (b Bot) handleDeckName(id int64, mode brain.Mode, msg string) {
+	name := strings.TrimSpace(msg)
+	if name == "" {
+		b.send(id, messageDeckNameEmpty, buttonsDeckName, nil)
+		return
+	}
+	var reply string
+	if mode == brain.ModeAddDeck {
+		deckID, err := b.store.AddDeck(id, name)
+		if err == brain.ErrDeckExists {
+			b.send(id, fmt.Sprintf(messageDeckExists, name), buttonsDeckName, nil)
+			return
+		}
+		if err != nil {
+			b.send(id, messageErr, buttonsDeckName, err)
+			return
+		}
+		settings, err := b.store.GetDeckSettings(id)
+		if err != nil {
+			b.send(id, messageErr, buttonsDeckName, err)
+			return
+		}
+		settings.Current = deckID
+		if err := b.store.SetDeckSettings(id, settings); err != nil {
+			b.send(id, messageErr, buttonsDeckName, err)
+			return
+		}
+		reply = fmt.Sprintf(messageDeckAdded, name)
+	} else {
+		settings, err := b.store.GetDeckSettings(id)
+		if err != nil {
+			b.send(id, messageErr, buttonsDeckName, err)
+			return
+		}
+		err = b.store.RenameDeck(id, settings.Current, name)
+		if err == brain.ErrDeckExists {
+			b.send(id, fmt.Sprintf(messageDeckExists, name), buttonsDeckName, nil)
+			return
+		}
+		if err != nil {
+			b.send(id, messageErr, buttonsDeckName, err)
+			return
+		}
+		reply = fmt.Sprintf(messageDeckRenamed, name)
+	}
+	if err := b.store.SetMode(id, brain.ModeMenu); err != nil {
+		b.send(id, messageErr, buttonsMenuMode, err)
+		return
+	}
+	b.send(id, reply, nil, nil)
+	b.send(b.messageDecks(id))
+}
+
+func (b Bot) currentDeck(id int64) (brain.Deck, error) {
+	settings, err := b.store.GetDeckSettings(id)
+	if err != nil {
+		return brain.Deck{}, err
+	}
+	return b.store.GetDeck(id, settings.Current)
+}
+
+// Shorten s to at most n characters.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "\u2026"
+}
@@ -0,0 +1,112 @@
+package messenger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/fbot"
+)
+
+var directions = []brain.Direction{
+	brain.DirectionForward,
+	brain.DirectionReverse,
+	brain.DirectionBoth,
+}
+
+var directionButtonTexts = map[brain.Direction]string{
+	brain.DirectionForward: "\u2192 one way",
+	brain.DirectionReverse: "\u2190 reverse",
+	brain.DirectionBoth:    "\u2194 both ways",
+}
+
+var directionDescriptions = map[brain.Direction]string{
+	brain.DirectionForward: "from explanation to phrase",
+	brain.DirectionReverse: "from phrase to explanation",
+	brain.DirectionBoth:    "in both directions",
+}
+
+// Buttons to continue adding phrases
+// and to change the direction of the phrase that has just been added.
+func (b Bot) buttonsAddNext(id, phraseID int64) []fbot.Button {
+	deck, err := b.currentDeck(id)
+	if err != nil {
+		b.err.Println(err)
+		return buttonsAddMode
+	}
+	buttons := append([]fbot.Button{}, buttonsAddMode...)
+	for _, d := range directions {
+		if d == deck.Direction {
+			continue
+		}
+		buttons = append(buttons, fbot.Button{
+			Text:    directionButtonTexts[d],
+			Payload: fmt.Sprintf("%s%d_%d", payloadPhraseDirection, d, phraseID),
+		})
+	}
+	return buttons
+}
+
+func (b Bot) setPhraseDirection(id int64, payload string) (int64, string, []fbot.Button, error) {
+	parts := strings.Split(strings.TrimPrefix(payload, payloadPhraseDirection), "_")
+	if len(parts) != 2 {
+		return id, messageErr, buttonsAddMode, fmt.Errorf("invalid direction payload '%s'", payload)
+	}
+	d, err := parseDirection(parts[0])
+	if err != nil {
+		return id, messageErr, buttonsAddMode, err
+	}
+	phraseID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return id, messageErr, buttonsAddMode, fmt.Errorf("failed to parse phrase in payload '%s': %v", payload, err)
+	}
+	if err := b.store.SetPhraseDirection(id, phraseID, d); err != nil {
+		return id, messageErr, buttonsAddMode, err
+	}
+	return id, fmt.Sprintf(messagePhraseDirectionSet, directionDescriptions[d]), buttonsAddMode, nil
+}
+
+func (b Bot) messageDeckDirection(id int64) (int64, string, []fbot.Button, error) {
+	deck, err := b.currentDeck(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	var buttons []fbot.Button
+	for _, d := range directions {
+		buttons = append(buttons, fbot.Button{
+			Text:    directionButtonTexts[d],
+			Payload: fmt.Sprintf("%s%d", payloadDeckDirection, d),
+		})
+	}
+	buttons = append(buttons, fbot.Button{Text: "cancel", Payload: payloadShowDecks})
+	msg := fmt.Sprintf(messageDeckDirection, deck.Name, directionDescriptions[deck.Direction])
+	return id, msg, buttons, nil
+}
+
+func (b Bot) setDeckDirection(id int64, payload string) (int64, string, []fbot.Button, error) {
+	d, err := parseDirection(strings.TrimPrefix(payload, payloadDeckDirection))
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	deck, err := b.currentDeck(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	if err := b.store.SetDeckDirection(id, deck.ID, d); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	return id, fmt.Sprintf(messageDeckDirectionSet, deck.Name, directionDescriptions[d]), buttonsMenuMode, nil
+}
+
+func parseDirection(s string) (brain.Direction, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse direction '%s': %v", s, err)
+	}
+	d := brain.Direction(i)
+	if _, ok := directionDescriptions[d]; !ok {
+		return 0, fmt.Errorf("unknown direction %d", i)
+	}
+	return d, nil
+}
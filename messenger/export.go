@@ -0,0 +1,39 @@
+package messenger
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/fbot"
+)
+
+var formatButtonTexts = map[brain.Format]string{
+	brain.FormatCSV:   "CSV",
+	brain.FormatAnki:  "Anki",
+	brain.FormatJSONL: "JSON Lines",
+}
+
+// Ask which format the user wants to download the phrases in.
+func (b Bot) messageExport(id int64) (int64, string, []fbot.Button, error) {
+	var buttons []fbot.Button
+	for _, f := range brain.Formats {
+		buttons = append(buttons, fbot.Button{Text: formatButtonTexts[f], Payload: payloadExport + string(f)})
+	}
+	buttons = append(buttons, fbot.Button{Text: "cancel", Payload: payloadStartMenu})
+	return id, messageExport, buttons, nil
+}
+
+// Send all phrases of the user as file in the format of the payload.
+func (b Bot) sendExport(id int64, payload string) (int64, string, []fbot.Button, error) {
+	format := brain.Format(strings.TrimPrefix(payload, payloadExport))
+	var buf bytes.Buffer
+	if err := b.store.Export(id, format, &buf); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	name := "phrases." + format.Extension()
+	if err := b.client.SendFile(id, name, format.ContentType(), &buf); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	return id, messageExportDone, buttonsMenuMode, nil
+}
@@ -0,0 +1,124 @@
+package messenger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/fbot"
+)
+
+// Tell the user a phrase has been suspended and offer ways to continue with it.
+func (b Bot) messageLeech(id, phraseID int64) (int64, string, []fbot.Button, error) {
+	p, err := b.store.GetPhrase(id, phraseID)
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	buttons := []fbot.Button{
+		fbot.Button{Text: buttonEdit.Text, Payload: fmt.Sprintf("%s%d", payloadLeechEdit, phraseID)},
+		fbot.Button{Text: "start from scratch", Payload: fmt.Sprintf("%s%d", payloadLeechReset, phraseID)},
+		fbot.Button{Text: "keep studying it", Payload: fmt.Sprintf("%s%d", payloadLeechKeep, phraseID)},
+		fbot.Button{Text: "continue", Payload: payloadContinueStudy},
+	}
+	msg := fmt.Sprintf(messageLeech, p.Lapses, joinAlternatives(p.Phrase, p.Alternatives), p.Explanation)
+	return id, msg, buttons, nil
+}
+
+// Start editing the phrase that has just been suspended.
+func (b Bot) startEditLeech(id int64, payload string) (int64, string, []fbot.Button, error) {
+	phraseID, err := parsePhraseID(payload, payloadLeechEdit)
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	p, err := b.store.GetPhrase(id, phraseID)
+	if err == brain.ErrPhraseNotFound {
+		return b.startStudy(id)
+	}
+	if err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	if err := b.store.SetModePhrase(id, brain.ModeEditLeech, phraseID); err != nil {
+		return id, messageErr, buttonsStudyMode, err
+	}
+	msg := fmt.Sprintf(messageStartEdit, joinAlternatives(p.Phrase, p.Alternatives), p.Explanation)
+	return id, msg, buttonsEditMode, nil
+}
+
+func (b Bot) keepLeech(id int64, payload string) {
+	phraseID, err := parsePhraseID(payload, payloadLeechKeep)
+	if err != nil {
+		b.send(id, messageErr, buttonsStudyMode, err)
+		return
+	}
+	if err := b.store.UnsuspendPhrase(id, phraseID); err != nil && err != brain.ErrPhraseNotFound {
+		b.send(id, messageErr, buttonsStudyMode, err)
+		return
+	}
+	b.send(id, messageLeechKeep, nil, nil)
+	b.send(b.startStudy(id))
+}
+
+func (b Bot) resetLeech(id int64, payload string) {
+	phraseID, err := parsePhraseID(payload, payloadLeechReset)
+	if err != nil {
+		b.send(id, messageErr, buttonsStudyMode, err)
+		return
+	}
+	if err := b.store.ResetPhrase(id, phraseID); err != nil && err != brain.ErrPhraseNotFound {
+		b.send(id, messageErr, buttonsStudyMode, err)
+		return
+	}
+	b.send(id, messageLeechReset, nil, nil)
+	b.send(b.startStudy(id))
+}
+
+// List suspended phrases with buttons to unsuspend them.
+func (b Bot) messageSuspended(id int64) (int64, string, []fbot.Button, error) {
+	leeches, err := b.store.GetSuspended(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	if len(leeches) == 0 {
+		return id, messageSuspendedEmpty, buttonsMenuMode, nil
+	}
+	msg := messageSuspended
+	var buttons []fbot.Button
+	for i, l := range leeches {
+		msg += fmt.Sprintf("\n%d. %s - %s", i+1, l.Phrase.Phrase, l.Phrase.Explanation)
+		if len(buttons) < maxButtons-1 {
+			buttons = append(buttons, fbot.Button{
+				Text:    fmt.Sprintf("unsuspend %d", i+1),
+				Payload: fmt.Sprintf("%s%d", payloadUnsuspend, l.PhraseID),
+			})
+		}
+	}
+	buttons = append(buttons, fbot.Button{Text: "back", Payload: payloadStartMenu})
+	return id, msg, buttons, nil
+}
+
+func (b Bot) unsuspend(id int64, payload string) (int64, string, []fbot.Button, error) {
+	phraseID, err := parsePhraseID(payload, payloadUnsuspend)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	p, err := b.store.GetPhrase(id, phraseID)
+	if err == brain.ErrPhraseNotFound {
+		return b.messageSuspended(id)
+	}
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	if err := b.store.UnsuspendPhrase(id, phraseID); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	return id, fmt.Sprintf(messageUnsuspended, p.Phrase), buttonsMenuMode, nil
+}
+
+func parsePhraseID(payload, prefix string) (int64, error) {
+	phraseID, err := strconv.ParseInt(strings.TrimPrefix(payload, prefix), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse phrase in payload '%s': %v", payload, err)
+	}
+	return phraseID, nil
+}
@@ -6,7 +6,9 @@ Please use the buttons below.`
 	messageHelp     = "How can I help you?"
 	messageIdle     = "Good, just send me a \U0001F44D to continue with your studies."
 	messageStartAdd = `Please send me a phrase and its explanation.
-Separate them with a linebreak.`
+Separate them with a linebreak.
+If there are multiple correct versions of the phrase, separate them with "|".
+To learn words in context, send a sentence and mark the gaps like this: {{c1::word}}`
 	messageWelcome = `Hello %s!
 
 Whenever you pick up a new phrase, just add it to your Studybot and remember it forever.
@@ -68,4 +70,106 @@ Would you like me to send you a message when there are phrases ready for studyin
 	messageFeedbackDone = "Thanks, you will hear from us soon."
 	greeting            = `Studybot helps you with our language studies.
 Master the language you encounter in your every day life instead of being limited to a textbook.`
+	messageStats = `Your progress:
+
+%d phrases: %d new, %d learning, %d mature
+Studied today: %d
+Known in the last 7 days: %s
+Known in the last 30 days: %s
+Streak: %d days
+
+Due in the next 7 days:
+%s`
+	messageDecks = `Your decks:
+
+%s
+
+New phrases are added to %s.
+%s
+
+Pick a deck to add and study only its phrases.`
+	messageDecksStudyAll     = "You study the phrases of all decks."
+	messageDecksStudyCurrent = "You only study the phrases of the current deck."
+	messageDeckSelected      = "Good, you will add and study phrases in %s."
+	messageStudyAllDecks     = "Good, you will study the phrases of all decks."
+	messageAddDeck           = "Please send me the name of the new deck."
+	messageDeckAdded         = "Created deck %s. New phrases are added to it now."
+	messageRenameDeck        = "Please send me the new name for %s."
+	messageDeckRenamed       = "The deck is called %s now."
+	messageDeckNameEmpty     = "Please send a name."
+	messageDeckExists        = "You already have a deck called %s. Please send a different name."
+	messageConfirmDeleteDeck = "Are you sure, you want to delete %s together with all its phrases?"
+	messageDeckDeleted       = "The deck has been deleted."
+	messageDeleteDefaultDeck = "Sorry, this is your default deck. It cannot be deleted but you can rename it."
+	messageStartAddDeck      = "New phrases are added to %s."
+	messageDeckDirection     = `New phrases in %s are studied %s.
+How would you like to study new phrases?`
+	messageDeckDirectionSet     = "Good, new phrases in %s will be studied %s."
+	messagePhraseDirectionSet   = "Good, you will study this phrase %s."
+	messageStudyQuestionReverse = `%d. Do you remember what this means?
+
+%s
+
+Use the buttons or type the explanation.`
+	messageStartEdit = `Please send me the corrected phrase and its explanation.
+Separate them with a linebreak.
+
+The phrase is currently saved as:
+
+%s
+%s`
+	messageCancelEdit = "Good, let's keep the phrase as it is and continue studying."
+	messageStudyClose = `Almost! Watch out for the marked part:
+
+%s`
+	messageStudyQuestionCloze = `%d. Do you remember what is missing?
+
+%s
+
+Use the buttons or type the missing part.`
+	messageAddClozeDone = `Saved text with %d gaps:
+%s`
+	messageClozeExists = "You already saved the same text."
+	messageClozeEmpty  = "Please mark the gaps in the text like this: {{c1::word}}"
+	messageQuizWrong   = `Sorry, %d is not right. The right version is:
+
+%s`
+	messageQuizStale = "This question has been answered already."
+	messageLeech     = `You forgot this phrase %d times:
+
+%s
+%s
+
+I won't ask you about it anymore. Maybe it helps to change the explanation or to add an example?
+You can also start learning it from scratch or keep studying it as it is.`
+	messageLeechKeep      = "Good, let's keep studying it."
+	messageLeechReset     = "Good, you will study it again as if it was new."
+	messageSuspended      = "These phrases are suspended because you forgot them many times:\n"
+	messageSuspendedEmpty = "You have no suspended phrases."
+	messageUnsuspended    = "Good, you will study this phrase again:\n%s"
+	messageUndone         = "Good, let's try this one again."
+	messageUndoNothing    = "There is nothing to undo."
+	messageSettings       = `Your settings:
+
+%s
+
+What would you like to change?`
+	messageSettingSet = "Good, %s: %s."
+	messageExport     = `Which format would you like to download your phrases in?
+
+CSV works with spreadsheets, Anki can import the notes and JSON Lines contains all data including your study history.`
+	messageExportDone = "Here are all your phrases."
+	messageDeleteData = `This deletes all your phrases, your study history and your settings.
+
+You might want to download your phrases first.`
+	messageConfirmDeleteData = "Are you really sure? Your data cannot be restored."
+	messageDataDeleted       = "All your data has been deleted. Send me a message if you ever want to start again."
+	messagePaused            = `Enjoy your time off! I won't remind you to study while you are away.
+
+Just start studying again when you are back.`
+	messageResumed   = "Welcome back! You have been away for %s. I moved all your studies by that time so they didn't pile up."
+	messageNotPaused = "Your studies are not paused."
+	messageBacklog   = `%d phrases are waiting for you. To make catching up easier, let's study the %d most urgent ones now.
+
+I spread the others over the next %s. Phrases you know well can wait a bit longer.`
 )
@@ -7,10 +7,12 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/jorinvo/studybot/brain"
 	"github.com/jorinvo/studybot/fbot"
+	"github.com/jorinvo/studybot/grade"
 )
 
 // Feedback describes a message from a user a human has to react to
@@ -30,10 +32,38 @@ type Bot struct {
 	client       fbot.Client
 	verifyToken  string
 	feedback     chan<- Feedback
-	notifyTimers map[int64]*time.Timer
+	notifyTimers *timers
+	asked        *askTimes
+	grader       grade.Grader
 	http.Handler
 }
 
+// Keeps track of when a study has been sent to a chat
+// to measure how long the user takes to answer.
+type askTimes struct {
+	sync.Mutex
+	times map[int64]time.Time
+}
+
+func (a *askTimes) set(id int64, t time.Time) {
+	a.Lock()
+	defer a.Unlock()
+	a.times[id] = t
+}
+
+// Returns the time since the last study has been sent.
+// Returns 0 if unknown.
+func (a *askTimes) since(id int64) time.Duration {
+	a.Lock()
+	defer a.Unlock()
+	t, ok := a.times[id]
+	if !ok {
+		return 0
+	}
+	delete(a.times, id)
+	return time.Since(t)
+}
+
 // Setup sends greetings and the getting started message to Facebook.
 func Setup(b *Bot) {
 	b.setup = true
@@ -60,6 +90,15 @@ func Verify(token string) func(*Bot) {
 	}
 }
 
+// Language is an option to set the language of the studied phrases.
+// It's used to decide which differences are tolerated in typed answers.
+// Pass an ISO 639-1 code like "es".
+func Language(lang string) func(*Bot) {
+	return func(b *Bot) {
+		b.grader = grade.New(lang)
+	}
+}
+
 // GetFeedback sets up user feedback to be sent to the given channel.
 func GetFeedback(f chan<- Feedback) func(*Bot) {
 	return func(b *Bot) {
@@ -69,17 +108,19 @@ func GetFeedback(f chan<- Feedback) func(*Bot) {
 
 // Notify enables sending notifications when studies are ready.
 func Notify(b *Bot) {
-	b.notifyTimers = map[int64]*time.Timer{}
+	b.notifyTimers = &timers{timers: map[int64]*time.Timer{}}
 }
 
 // New creates a Bot.
 // It can be used as a HTTP handler for the webhook.
-// The options Setup, LogInfo, LogErr, Notify, Verify, GetFeedback can be used.
+// The options Setup, LogInfo, LogErr, Notify, Verify, GetFeedback, Language can be used.
 func New(store brain.Store, token string, options ...func(*Bot)) (Bot, error) {
 	client := fbot.New(token)
 	b := Bot{
 		store:  store,
 		client: client,
+		asked:  &askTimes{times: map[int64]time.Time{}},
+		grader: grade.New(""),
 	}
 
 	for _, option := range options {
@@ -2,11 +2,40 @@ package messenger
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/jorinvo/studybot/brain"
 )
 
+// Notification timers by chat.
+// Timers are set from handlers as well as from running timers.
+type timers struct {
+	sync.Mutex
+	timers map[int64]*time.Timer
+}
+
+// Run fn after d for the given chat and stop the previous timer of the chat.
+func (t *timers) set(id int64, d time.Duration, fn func()) {
+	t.Lock()
+	defer t.Unlock()
+	if timer := t.timers[id]; timer != nil {
+		// Don't care if timer is active or not
+		_ = timer.Stop()
+	}
+	t.timers[id] = time.AfterFunc(d, fn)
+}
+
+// Stop the timer of the given chat.
+func (t *timers) stop(id int64) {
+	t.Lock()
+	defer t.Unlock()
+	if timer := t.timers[id]; timer != nil {
+		_ = timer.Stop()
+		delete(t.timers, id)
+	}
+}
+
 // Start a timer to notify the given chat.
 // Only works when chat has notifications enabled
 // and has added some phrases already.
@@ -24,10 +53,7 @@ func (b Bot) scheduleNotify(id int64) {
 		return
 	}
 
-	if timer := b.notifyTimers[id]; timer != nil {
-		// Don't care if timer is active or not
-		_ = timer.Stop()
-	}
+	b.notifyTimers.stop(id)
 	d, count, err := b.store.GetNotifyTime(id)
 	if err != nil {
 		b.err.Println(err)
@@ -38,17 +64,55 @@ func (b Bot) scheduleNotify(id int64) {
 	}
 
 	b.info.Printf("Notify %d in %s with %d due studies", id, d.String(), count)
-	b.notifyTimers[id] = time.AfterFunc(d, func() {
+	b.notifyTimers.set(id, d, func() {
 		b.notify(id, count)
 	})
 }
 
+// Stop the notification timer of the given chat.
+func (b Bot) stopNotify(id int64) {
+	if b.notifyTimers == nil {
+		return
+	}
+	b.notifyTimers.stop(id)
+}
+
 func (b Bot) notify(id int64, count int) {
+	// The user might have unsubscribed, paused or deleted their data since scheduling
+	isSubscribed, err := b.store.IsSubscribed(id)
+	if err != nil {
+		b.err.Println(err)
+		return
+	}
+	if !isSubscribed {
+		return
+	}
+	if since, err := b.store.PausedSince(id); err != nil || !since.IsZero() {
+		if err != nil {
+			b.err.Println(err)
+		}
+		return
+	}
 	p, err := b.client.GetProfile(id)
 	name := p.Name
 	if err != nil {
 		name = "there"
 		b.err.Printf("failed to get profile for %d: %v", id, err)
+	} else {
+		b.updateTimezone(id, p)
+	}
+	// Wait for the quiet hours to end in the timezone of the user
+	settings, err := b.store.GetUserSettings(id)
+	if err != nil {
+		b.err.Println(err)
+	}
+	now := time.Now().In(time.FixedZone("", int(p.Timezone*60*60)))
+	if d := settings.QuietUntil(now); d > 0 {
+		b.info.Printf("Notify %d in %s after quiet hours", id, d.String())
+		b.notifyTimers.set(id, d, func() {
+			b.notify(id, count)
+		})
+		return
 	}
 	msg := fmt.Sprintf(messageStudiesDue, name, count)
 	if err := b.store.SetMode(id, brain.ModeMenu); err != nil {
@@ -0,0 +1,57 @@
+package messenger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jorinvo/studybot/fbot"
+)
+
+// Pause the schedule while the user is away.
+func (b Bot) pause(id int64) (int64, string, []fbot.Button, error) {
+	if err := b.store.Pause(id, time.Now()); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	b.stopNotify(id)
+	return id, messagePaused, buttonsMenuMode, nil
+}
+
+// End the pause and tell the user how far the studies have been moved.
+func (b Bot) resume(id int64) (int64, string, []fbot.Button, error) {
+	paused, err := b.store.Resume(id, time.Now())
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	if paused == 0 {
+		return id, messageNotPaused, buttonsMenuMode, nil
+	}
+	b.scheduleNotify(id)
+	return id, fmt.Sprintf(messageResumed, formatDays(paused)), buttonsMenuMode, nil
+}
+
+// Studying ends the pause since the user is back.
+func (b Bot) resumeIfPaused(id int64) {
+	since, err := b.store.PausedSince(id)
+	if err != nil {
+		b.err.Println(err)
+		return
+	}
+	if since.IsZero() {
+		return
+	}
+	_, msg, _, err := b.resume(id)
+	b.send(id, msg, nil, err)
+}
+
+// Format like "X day[s]".
+// Durations shorter than a day are formatted like formatDuration.
+func formatDays(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	if days > 1 {
+		return fmt.Sprintf("%d days", days)
+	}
+	if days == 1 {
+		return "1 day"
+	}
+	return formatDuration(d)
+}
@@ -18,4 +18,48 @@ const (
 	payloadUnsubscribe    = "PAYLOAD_UNSUBSCRIBE"
 	payloadNoSubscription = "PAYLOAD_NOSUBSCRIPTION"
 	payloadFeedback       = "PAYLOAD_FEEDBACK"
+	payloadShowStats      = "PAYLOAD_SHOWSTATS"
+	payloadShowDecks      = "PAYLOAD_SHOWDECKS"
+	payloadEdit           = "PAYLOAD_EDIT"
+	payloadCancelEdit     = "PAYLOAD_CANCELEDIT"
+	// Followed by the deck ID
+	payloadSelectDeck        = "PAYLOAD_SELECTDECK_"
+	payloadStudyAllDecks     = "PAYLOAD_STUDYALLDECKS"
+	payloadAddDeck           = "PAYLOAD_ADDDECK"
+	payloadRenameDeck        = "PAYLOAD_RENAMEDECK"
+	payloadDeleteDeck        = "PAYLOAD_DELETEDECK"
+	payloadConfirmDeleteDeck = "PAYLOAD_CONFIRMDELETEDECK"
+	payloadShowDeckDirection = "PAYLOAD_SHOWDECKDIRECTION"
+	// Followed by the direction
+	payloadDeckDirection = "PAYLOAD_DECKDIRECTION_"
+	// Followed by the direction, an underscore and the phrase ID
+	payloadPhraseDirection = "PAYLOAD_PHRASEDIRECTION_"
+	payloadStartQuiz       = "PAYLOAD_STARTQUIZ"
+	// Followed by the phrase ID, question checksum, chosen option and 1 if the option is correct,
+	// all separated by underscores
+	payloadQuiz = "PAYLOAD_QUIZ_"
+	// Followed by the phrase ID
+	payloadLeechKeep = "PAYLOAD_LEECHKEEP_"
+	// Followed by the phrase ID
+	payloadLeechReset = "PAYLOAD_LEECHRESET_"
+	// Followed by the phrase ID
+	payloadUnsuspend = "PAYLOAD_UNSUSPEND_"
+	// Followed by the phrase ID
+	payloadLeechEdit     = "PAYLOAD_LEECHEDIT_"
+	payloadContinueStudy = "PAYLOAD_CONTINUESTUDY"
+	payloadShowSuspended = "PAYLOAD_SHOWSUSPENDED"
+	payloadUndo          = "PAYLOAD_UNDO"
+	payloadShowSettings  = "PAYLOAD_SHOWSETTINGS"
+	// Followed by the setting
+	payloadShowSetting = "PAYLOAD_SHOWSETTING_"
+	// Followed by the setting, an underscore and the index of the chosen option
+	payloadSetting    = "PAYLOAD_SETTING_"
+	payloadShowExport = "PAYLOAD_SHOWEXPORT"
+	// Followed by the format
+	payloadExport            = "PAYLOAD_EXPORT_"
+	payloadDeleteData        = "PAYLOAD_DELETEDATA"
+	payloadConfirmDeleteData = "PAYLOAD_CONFIRMDELETEDATA"
+	payloadDeleteDataNow     = "PAYLOAD_DELETEDATANOW"
+	payloadPause             = "PAYLOAD_PAUSE"
+	payloadResume            = "PAYLOAD_RESUME"
 )
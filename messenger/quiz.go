@@ -0,0 +1,111 @@
+package messenger
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/fbot"
+)
+
+// Number of wrong answers offered together with the correct one
+const quizDistractors = 3
+
+// Options are encoded in the payload as
+// phrase ID, question checksum, chosen option and if the option is correct.
+// The checksum tells apart the different studies of the same phrase.
+func quizPayload(study brain.Study, option int, correct bool) string {
+	isCorrect := 0
+	if correct {
+		isCorrect = 1
+	}
+	return fmt.Sprintf("%s%d_%d_%d_%d", payloadQuiz, study.PhraseID, questionChecksum(study), option, isCorrect)
+}
+
+func questionChecksum(study brain.Study) uint32 {
+	return crc32.ChecksumIEEE([]byte(study.Explanation))
+}
+
+// Build the quiz buttons for a study.
+// The options are listed in the message if they don't fit on the buttons.
+// Returns ok false if the chat doesn't have enough phrases for a quiz.
+func (b Bot) quizQuestion(id int64, study brain.Study, question string) (string, []fbot.Button, bool, error) {
+	distractors, err := b.store.GetDistractors(id, study, quizDistractors)
+	if err != nil || len(distractors) < quizDistractors {
+		return question, nil, false, err
+	}
+	correct := rand.Intn(len(distractors) + 1)
+	options := append(distractors[:correct:correct], study.Phrase)
+	options = append(options, distractors[correct:]...)
+
+	fit := true
+	for _, o := range options {
+		fit = fit && len([]rune(o)) <= maxButtonText && !strings.Contains(o, "\n")
+	}
+	var buttons []fbot.Button
+	for i, o := range options {
+		text := o
+		if !fit {
+			text = strconv.Itoa(i + 1)
+			question += fmt.Sprintf("\n%d. %s", i+1, o)
+		}
+		buttons = append(buttons, fbot.Button{Text: text, Payload: quizPayload(study, i+1, i == correct)})
+	}
+	return question, append(buttons, buttonStudyDone), true, nil
+}
+
+func (b Bot) answerQuiz(id int64, payload string) {
+	parts := strings.Split(strings.TrimPrefix(payload, payloadQuiz), "_")
+	if len(parts) != 4 {
+		b.send(id, messageErr, buttonsStudyMode, fmt.Errorf("invalid quiz payload '%s'", payload))
+		return
+	}
+	phraseID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		b.send(id, messageErr, buttonsStudyMode, fmt.Errorf("failed to parse phrase in payload '%s': %v", payload, err))
+		return
+	}
+	checksum, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		b.send(id, messageErr, buttonsStudyMode, fmt.Errorf("failed to parse checksum in payload '%s': %v", payload, err))
+		return
+	}
+	option, err := strconv.Atoi(parts[2])
+	if err != nil {
+		b.send(id, messageErr, buttonsStudyMode, fmt.Errorf("failed to parse option in payload '%s': %v", payload, err))
+		return
+	}
+	correct := parts[3] == "1"
+
+	mode, err := b.store.GetMode(id)
+	if err != nil {
+		b.send(id, messageErr, buttonsMenuMode, fmt.Errorf("failed to get mode for id %v: %v", id, err))
+		return
+	}
+	if mode != brain.ModeQuiz {
+		b.send(id, messageQuizStale, buttonsMenuMode, nil)
+		return
+	}
+	study, err := b.store.GetStudy(id)
+	if err != nil {
+		b.send(id, messageErr, buttonsStudyMode, fmt.Errorf("failed to get study: %v", err))
+		return
+	}
+	// The button belongs to a question that has been answered already
+	if study.Total == 0 || study.PhraseID != phraseID || uint64(questionChecksum(study)) != checksum {
+		b.send(id, messageQuizStale, nil, nil)
+		b.send(b.startStudy(id))
+		return
+	}
+
+	if correct {
+		b.send(id, messageStudyCorrect, nil, nil)
+		b.send(b.scoreAndStudy(id, 1, false))
+		return
+	}
+	b.send(id, fmt.Sprintf(messageQuizWrong, option, study.Phrase), nil, nil)
+	b.send(b.scoreAndStudy(id, -1, false))
+}
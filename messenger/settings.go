@@ -0,0 +1,242 @@
+package messenger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jorinvo/studybot/brain"
+	"github.com/jorinvo/studybot/fbot"
+)
+
+// A setting the user can change in the settings menu.
+type setting struct {
+	// Name used in payloads
+	id string
+	// Text of the button to change the setting
+	button string
+	// Label in the list of settings
+	label    string
+	question string
+	describe func(brain.UserSettings) string
+	options  []settingOption
+}
+
+type settingOption struct {
+	text  string
+	apply func(*brain.UserSettings)
+}
+
+var strictnessDescriptions = map[brain.Strictness]string{
+	brain.StrictnessNormal:  "small typos are almost right",
+	brain.StrictnessLenient: "small typos are right",
+	brain.StrictnessStrict:  "small typos are wrong",
+}
+
+// Quiet hours to choose from as pairs of start and end hour
+var quietHours = [][2]int{{0, 0}, {22, 7}, {23, 8}, {21, 9}}
+
+var userSettings = []setting{
+	{
+		id:       "NEWPERDAY",
+		button:   "new per day",
+		label:    "New phrases per day",
+		question: "How many new phrases would you like to study per day?",
+		describe: func(s brain.UserSettings) string { return strconv.Itoa(s.NewPerDay) },
+		options: intOptions([]int{10, 20, 30, 50, 100}, func(s *brain.UserSettings, n int) {
+			s.NewPerDay = n
+		}),
+	},
+	{
+		id:       "NOTIFY",
+		button:   "notifications",
+		label:    "Notify when due",
+		question: "How many phrases should be ready before I remind you to study?",
+		describe: func(s brain.UserSettings) string { return strconv.Itoa(s.NotifyMinCount) },
+		options: intOptions([]int{1, 5, 9, 20, 50}, func(s *brain.UserSettings, n int) {
+			s.NotifyMinCount = n
+		}),
+	},
+	{
+		id:       "STRICTNESS",
+		button:   "typos",
+		label:    "Typed answers",
+		question: "How should I grade typed answers with small typos?",
+		describe: func(s brain.UserSettings) string { return strictnessDescriptions[s.Strictness] },
+		options: []settingOption{
+			{"almost right", func(s *brain.UserSettings) { s.Strictness = brain.StrictnessNormal }},
+			{"right", func(s *brain.UserSettings) { s.Strictness = brain.StrictnessLenient }},
+			{"wrong", func(s *brain.UserSettings) { s.Strictness = brain.StrictnessStrict }},
+		},
+	},
+	{
+		id:       "DIRECTION",
+		button:   "direction",
+		label:    "New decks are studied",
+		question: "How would you like to study phrases of new decks?",
+		describe: func(s brain.UserSettings) string { return directionDescriptions[s.Direction] },
+		options:  directionOptions(),
+	},
+	{
+		id:       "QUIET",
+		button:   "quiet hours",
+		label:    "Quiet hours",
+		question: "When should I not send you any reminders?",
+		describe: func(s brain.UserSettings) string { return formatQuietHours(s.QuietFrom, s.QuietTo) },
+		options:  quietHoursOptions(),
+	},
+	{
+		id:       "BACKLOG",
+		button:   "catching up",
+		label:    "Catch up per day",
+		question: "How many overdue phrases would you like to study per day when catching up after a break?",
+		describe: func(s brain.UserSettings) string { return strconv.Itoa(s.BacklogPerDay) },
+		options: intOptions([]int{20, 50, 100, 200}, func(s *brain.UserSettings, n int) {
+			s.BacklogPerDay = n
+		}),
+	},
+}
+
+func intOptions(values []int, set func(*brain.UserSettings, int)) []settingOption {
+	var options []settingOption
+	for _, n := range values {
+		n := n
+		options = append(options, settingOption{
+			text:  strconv.Itoa(n),
+			apply: func(s *brain.UserSettings) { set(s, n) },
+		})
+	}
+	return options
+}
+
+func directionOptions() []settingOption {
+	var options []settingOption
+	for _, d := range directions {
+		d := d
+		options = append(options, settingOption{
+			text:  directionButtonTexts[d],
+			apply: func(s *brain.UserSettings) { s.Direction = d },
+		})
+	}
+	return options
+}
+
+func quietHoursOptions() []settingOption {
+	var options []settingOption
+	for _, h := range quietHours {
+		h := h
+		options = append(options, settingOption{
+			text:  formatQuietHours(h[0], h[1]),
+			apply: func(s *brain.UserSettings) { s.QuietFrom, s.QuietTo = h[0], h[1] },
+		})
+	}
+	return options
+}
+
+// Format like "22:00 - 7:00".
+// Returns "none" if there are no quiet hours.
+func formatQuietHours(from, to int) string {
+	if from == to {
+		return "none"
+	}
+	return fmt.Sprintf("%d:00 - %d:00", from, to)
+}
+
+func findSetting(id string) (setting, bool) {
+	for _, s := range userSettings {
+		if s.id == id {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// List the current settings and offer to change them.
+func (b Bot) messageSettings(id int64) (int64, string, []fbot.Button, error) {
+	current, err := b.store.GetUserSettings(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	var lines []string
+	var buttons []fbot.Button
+	for _, s := range userSettings {
+		lines = append(lines, fmt.Sprintf("%s: %s", s.label, s.describe(current)))
+		buttons = append(buttons, fbot.Button{Text: s.button, Payload: payloadShowSetting + s.id})
+	}
+	buttons = append(buttons, fbot.Button{Text: "back", Payload: payloadStartMenu})
+	return id, fmt.Sprintf(messageSettings, strings.Join(lines, "\n")), buttons, nil
+}
+
+// Ask for a new value of the setting of the payload.
+func (b Bot) messageSetting(id int64, payload string) (int64, string, []fbot.Button, error) {
+	s, ok := findSetting(strings.TrimPrefix(payload, payloadShowSetting))
+	if !ok {
+		return id, messageErr, buttonsMenuMode, fmt.Errorf("unknown setting in payload '%s'", payload)
+	}
+	var buttons []fbot.Button
+	for i, o := range s.options {
+		buttons = append(buttons, fbot.Button{
+			Text:    o.text,
+			Payload: fmt.Sprintf("%s%s_%d", payloadSetting, s.id, i),
+		})
+	}
+	buttons = append(buttons, fbot.Button{Text: "cancel", Payload: payloadShowSettings})
+	return id, s.question, buttons, nil
+}
+
+// Change a setting to the option of the payload.
+func (b Bot) setSetting(id int64, payload string) (int64, string, []fbot.Button, error) {
+	parts := strings.Split(strings.TrimPrefix(payload, payloadSetting), "_")
+	if len(parts) != 2 {
+		return id, messageErr, buttonsMenuMode, fmt.Errorf("invalid setting payload '%s'", payload)
+	}
+	s, ok := findSetting(parts[0])
+	if !ok {
+		return id, messageErr, buttonsMenuMode, fmt.Errorf("unknown setting in payload '%s'", payload)
+	}
+	i, err := strconv.Atoi(parts[1])
+	if err != nil || i < 0 || i >= len(s.options) {
+		return id, messageErr, buttonsMenuMode, fmt.Errorf("invalid option in setting payload '%s'", payload)
+	}
+	current, err := b.store.GetUserSettings(id)
+	if err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	s.options[i].apply(&current)
+	if err := b.store.SetUserSettings(id, current); err != nil {
+		return id, messageErr, buttonsMenuMode, err
+	}
+	// The notification threshold and quiet hours might have changed
+	b.scheduleNotify(id)
+	b.send(id, fmt.Sprintf(messageSettingSet, s.label, s.describe(current)), nil, nil)
+	return b.messageSettings(id)
+}
+
+// Remember the timezone of the user from the profile
+// so new phrases are counted per day of the user.
+func (b Bot) updateTimezone(id int64, p fbot.Profile) {
+	settings, err := b.store.GetUserSettings(id)
+	if err != nil {
+		b.err.Println(err)
+		return
+	}
+	if settings.Timezone == p.Timezone {
+		return
+	}
+	settings.Timezone = p.Timezone
+	if err := b.store.SetUserSettings(id, settings); err != nil {
+		b.err.Printf("failed to set timezone %v for %d: %v", p.Timezone, id, err)
+	}
+}
+
+// Score a typed answer depending on how strict the user wants to be graded.
+// Close answers count as almost known by default.
+func closeScore(strictness brain.Strictness) int {
+	switch strictness {
+	case brain.StrictnessLenient:
+		return 1
+	case brain.StrictnessStrict:
+		return -1
+	}
+	return 0
+}